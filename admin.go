@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Guard operational endpoints with the ADMIN_TOKEN bearer token. They
+// are disabled entirely when no token is configured.
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentConfig().AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if !isAdmin(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Whether r carries the ADMIN_TOKEN bearer token, which must be set
+func isAdmin(r *http.Request) bool {
+	adminToken := currentConfig().AdminToken
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return adminToken != "" && ok && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// Guard partner endpoints with one of the BATCH_API_KEYS, sent in the
+// X-API-Key header. Disabled entirely when no keys are configured.
+func requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := currentConfig().BatchAPIKeys
+		if len(keys) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if !hasAPIKey(r, keys) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Whether the X-API-Key header matches one of keys
+func hasAPIKey(r *http.Request, keys []string) bool {
+	given := []byte(r.Header.Get("X-API-Key"))
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare(given, []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// A file uploaded with the form. Small files stay in memory; anything
+// past ATTACHMENT_MEMORY_BYTES is spooled to a temp file, removed by
+// cleanup once the request is done.
+type attachment struct {
+	Filename    string
+	ContentType string
+	Size        int64
+
+	data []byte
+	path string
+}
+
+// File contents, read back from the spool file if there is one
+func (a *attachment) open() (io.ReadCloser, error) {
+	if a.path == "" {
+		return io.NopCloser(bytes.NewReader(a.data)), nil
+	}
+	return os.Open(a.path)
+}
+
+func cleanupAttachments(atts []*attachment) {
+	for _, a := range atts {
+		if a.path != "" {
+			if err := os.Remove(a.path); err != nil {
+				log.Println("Attachment spool cleanup:", err)
+			}
+		}
+	}
+}
+
+// Multipart form part holding files; every other part is a form field
+// under its JSON name
+const attachmentField = "attachments"
+
+func isMultipart(r *http.Request) bool {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mt == "multipart/form-data"
+}
+
+// Form fields settable from a multipart body, by JSON name
+func multipartFields(f *ContactForm) map[string]*string {
+	fields := conditionFields(f)
+	fields["recaptchaToken"] = &f.Token
+	fields["formToken"] = &f.FormToken
+	fields["locale"] = &f.Locale
+	return fields
+}
+
+// Stream a multipart/form-data body into form and its attachments. The
+// whole body is capped at ATTACHMENT_MAX_TOTAL_BYTES plus MAX_BODY_BYTES
+// for the fields, and each file at ATTACHMENT_MAX_BYTES, so nothing
+// larger is ever read. Like decodeJSONBody it returns the status and
+// message to answer with on failure; the caller must clean up the
+// returned attachments either way.
+func decodeMultipartBody(w http.ResponseWriter, r *http.Request, form *ContactForm, cfg *Config) ([]*attachment, int, string) {
+	if cfg.AttachmentMaxFiles == 0 {
+		return nil, http.StatusUnsupportedMediaType, "Attachments are not accepted"
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.AttachmentMaxTotalBytes+cfg.MaxBodyBytes)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid multipart body"
+	}
+
+	var (
+		atts       []*attachment
+		fieldBytes int64
+	)
+	fields := multipartFields(form)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return multipartError(atts, err)
+		}
+		name := part.FormName()
+		if part.FileName() == "" {
+			v, err := io.ReadAll(io.LimitReader(part, cfg.MaxBodyBytes-fieldBytes+1))
+			if err != nil {
+				return multipartError(atts, err)
+			}
+			if fieldBytes += int64(len(v)); fieldBytes > cfg.MaxBodyBytes {
+				return atts, http.StatusRequestEntityTooLarge, fmt.Sprintf("Form fields too large: at most %d bytes", cfg.MaxBodyBytes)
+			}
+			if p, ok := fields[name]; ok {
+				*p = string(v)
+			}
+			continue
+		}
+		if name != attachmentField {
+			continue
+		}
+		if len(atts) == cfg.AttachmentMaxFiles {
+			return atts, http.StatusRequestEntityTooLarge, fmt.Sprintf("Too many attachments: at most %d", cfg.AttachmentMaxFiles)
+		}
+		a, err := readAttachment(part, cfg)
+		if a != nil {
+			atts = append(atts, a)
+		}
+		if err == nil {
+			err = checkAttachmentType(a, cfg)
+		}
+		if err != nil {
+			return multipartError(atts, err)
+		}
+	}
+	return atts, 0, ""
+}
+
+// Typed so the handler can name the file that was too big
+type attachmentTooLargeError struct {
+	filename string
+	limit    int64
+}
+
+func (e *attachmentTooLargeError) Error() string {
+	return fmt.Sprintf("attachment %q too large: at most %d bytes", e.filename, e.limit)
+}
+
+// Extensions accepted by default and the types each may carry. Office
+// formats are ZIP containers as far as sniffing can tell.
+const defaultAttachmentTypes = "pdf=application/pdf,png=image/png,jpg=image/jpeg,jpeg=image/jpeg,gif=image/gif,webp=image/webp," +
+	"txt=text/plain,csv=text/plain,csv=text/csv," +
+	"docx=application/zip,docx=application/vnd.openxmlformats-officedocument.wordprocessingml.document," +
+	"xlsx=application/zip,xlsx=application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Parse ext=type pairs; an extension may be listed once per type
+func parseAttachmentTypes(raw string) (map[string][]string, error) {
+	types := map[string][]string{}
+	for _, pair := range splitList(raw) {
+		ext, mt, ok := strings.Cut(pair, "=")
+		ext = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+		mt = strings.ToLower(strings.TrimSpace(mt))
+		if !ok || ext == "" || !strings.Contains(mt, "/") {
+			return nil, fmt.Errorf("%q is not ext=type", pair)
+		}
+		types[ext] = append(types[ext], mt)
+	}
+	return types, nil
+}
+
+// Typed so the handler can name the file that was refused
+type attachmentTypeError struct {
+	filename string
+	reason   string
+}
+
+func (e *attachmentTypeError) Error() string {
+	return fmt.Sprintf("attachment %q %s", e.filename, e.reason)
+}
+
+// The extension must be in ATTACHMENT_TYPES, and both the sniffed content
+// and the declared type must be among the types listed for it, so an
+// executable renamed to .pdf is turned away. A generic declared type
+// such as application/octet-stream is replaced by the sniffed one.
+func checkAttachmentType(a *attachment, cfg *Config) error {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(a.Filename)), ".")
+	allowed, ok := cfg.AttachmentTypes[ext]
+	if !ok {
+		return &attachmentTypeError{filename: a.Filename, reason: "is not an accepted file type"}
+	}
+
+	f, err := a.open()
+	if err != nil {
+		return err
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	f.Close()
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if !slices.Contains(allowed, sniffed) {
+		return &attachmentTypeError{filename: a.Filename, reason: "content does not match its extension"}
+	}
+
+	declared, _, _ := mime.ParseMediaType(a.ContentType)
+	if declared == "application/octet-stream" {
+		a.ContentType = sniffed
+	} else if !slices.Contains(allowed, declared) {
+		return &attachmentTypeError{filename: a.Filename, reason: "declared type does not match its extension"}
+	}
+	return nil
+}
+
+// Copy one file part, in memory up to ATTACHMENT_MEMORY_BYTES and
+// spooled to disk beyond that. The returned attachment is non-nil
+// whenever a spool file exists, so it can be cleaned up.
+func readAttachment(part *multipart.Part, cfg *Config) (*attachment, error) {
+	a := &attachment{
+		// Only the base name; browsers send bare names but clients may not
+		Filename:    filepath.Base(strings.ReplaceAll(part.FileName(), `\`, "/")),
+		ContentType: part.Header.Get("Content-Type"),
+	}
+	if a.ContentType == "" {
+		a.ContentType = "application/octet-stream"
+	}
+	src := io.LimitReader(part, cfg.AttachmentMaxBytes+1)
+
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, src, cfg.AttachmentMemoryBytes+1)
+	a.Size = n
+	if err == io.EOF {
+		a.data = buf.Bytes()
+		if a.Size > cfg.AttachmentMaxBytes {
+			return nil, &attachmentTooLargeError{filename: a.Filename, limit: cfg.AttachmentMaxBytes}
+		}
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp("", "contact-attachment-*")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	a.path = f.Name()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return a, err
+	}
+	rest, err := io.Copy(f, src)
+	a.Size += rest
+	if err != nil {
+		return a, err
+	}
+	if a.Size > cfg.AttachmentMaxBytes {
+		return a, &attachmentTooLargeError{filename: a.Filename, limit: cfg.AttachmentMaxBytes}
+	}
+	return a, nil
+}
+
+func multipartError(atts []*attachment, err error) ([]*attachment, int, string) {
+	status, msg := multipartErrorStatus(err)
+	return atts, status, msg
+}
+
+func multipartErrorStatus(err error) (int, string) {
+	var (
+		maxErr  *http.MaxBytesError
+		sizeErr *attachmentTooLargeError
+		typeErr *attachmentTypeError
+	)
+	switch {
+	case errors.As(err, &maxErr):
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body too large: at most %d bytes", maxErr.Limit)
+	case errors.As(err, &sizeErr):
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("Attachment %q too large: at most %d bytes", sizeErr.filename, sizeErr.limit)
+	case errors.As(err, &typeErr):
+		return http.StatusBadRequest, fmt.Sprintf("Attachment %q %s", typeErr.filename, typeErr.reason)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest, "Request body is truncated"
+	default:
+		debugf("Multipart body error: %v", err)
+		return http.StatusBadRequest, "Invalid multipart body"
+	}
+}
+
+// Names and sizes for the stored record and the notification
+func attachmentSummary(atts []*attachment) []string {
+	var names []string
+	for _, a := range atts {
+		names = append(names, fmt.Sprintf("%s (%d bytes)", a.Filename, a.Size))
+	}
+	return names
+}
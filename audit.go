@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// One line of the audit log. Only non-PII metadata is recorded; the
+// reference ID links back to the stored submission.
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	Endpoint    string    `json:"endpoint"`
+	ReferenceID string    `json:"referenceId,omitempty"`
+	Outcome     string    `json:"outcome"`
+	Status      int       `json:"status,omitempty"`
+	FormType    string    `json:"formType,omitempty"`
+	Locale      string    `json:"locale,omitempty"`
+	Origin      string    `json:"origin,omitempty"`
+	DurationMs  int64     `json:"durationMs,omitempty"`
+}
+
+// Append-only JSON-lines file (AUDIT_LOG_FILE). The file is opened once;
+// when a write would take it past maxBytes it is renamed to path.1 (older
+// files shift up to path.<keep>) and a fresh file is opened.
+type auditWriter struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	keep     int
+	f        *os.File
+	size     int64
+}
+
+// Audit log sink, nil unless AUDIT_LOG_FILE is set
+var auditLog *auditWriter
+
+func openAuditLog(path string, maxBytes int64, keep int) (*auditWriter, error) {
+	a := &auditWriter{path: path, maxBytes: maxBytes, keep: keep}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *auditWriter) open() error {
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.f, a.size = f, info.Size()
+	return nil
+}
+
+// Reopens the log even when renaming fails, so records keep flowing to
+// the current file; a.f is nil only if the file can't be opened at all
+func (a *auditWriter) rotate() error {
+	a.f.Close()
+	for i := a.keep - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", a.path, i), fmt.Sprintf("%s.%d", a.path, i+1))
+	}
+	renameErr := os.Rename(a.path, a.path+".1")
+	if err := a.open(); err != nil {
+		a.f = nil
+		return err
+	}
+	return renameErr
+}
+
+func (a *auditWriter) write(rec auditRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Println("Audit log encode error:", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		if err := a.open(); err != nil {
+			log.Println("Audit log unavailable, record dropped:", err)
+			return
+		}
+	}
+	if a.maxBytes > 0 && a.size > 0 && a.size+int64(len(line)) > a.maxBytes {
+		if err := a.rotate(); err != nil {
+			log.Println("Audit log rotation failed:", err)
+			if a.f == nil {
+				return
+			}
+		}
+	}
+	n, err := a.f.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		log.Println("Audit log write error:", err)
+	}
+}
+
+func (a *auditWriter) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	return a.f.Close()
+}
+
+// Submission details the handler attaches to the request for its audit record
+type auditInfoKey struct{}
+
+type auditInfo struct {
+	sub *Submission
+	// Replaces the outcome derived from the status, for decoy replies
+	outcome string
+}
+
+// Note which submission the current request produced
+func auditSubmission(ctx context.Context, sub *Submission) {
+	if info, ok := ctx.Value(auditInfoKey{}).(*auditInfo); ok {
+		info.sub = sub
+	}
+}
+
+// Note that the request was silently dropped for reason, although the
+// client was answered as if it succeeded
+func auditDropped(ctx context.Context, reason string) {
+	if info, ok := ctx.Value(auditInfoKey{}).(*auditInfo); ok {
+		info.outcome = "dropped:" + reason
+	}
+}
+
+// Write one audit record per request once the handler has responded
+func auditMiddleware(endpoint string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auditLog == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		info := &auditInfo{}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), auditInfoKey{}, info)))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		entry := auditRecord{
+			Time:       start.UTC(),
+			Endpoint:   endpoint,
+			Outcome:    outcomeForStatus(rec.status),
+			Status:     rec.status,
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if info.outcome != "" {
+			entry.Outcome = info.outcome
+		}
+		if sub := info.sub; sub != nil {
+			entry.ReferenceID = sub.ID
+			entry.FormType = sub.Form.FormType
+			entry.Locale = sub.Form.Locale
+			entry.Origin = sub.Origin
+		}
+		auditLog.write(entry)
+	})
+}
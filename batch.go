@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Outcome of one item in a batch import, in request order
+type batchResult struct {
+	Index       int          `json:"index"`
+	Status      string       `json:"status"`
+	ReferenceID string       `json:"referenceId,omitempty"`
+	Errors      []FieldError `json:"errors,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// Bulk lead import for partners (POST /api/contact/batch, API-key gated).
+// Items skip reCAPTCHA and rate limiting but are otherwise validated,
+// stored and sent like web submissions; no auto-reply is sent. Sends run
+// at most BATCH_CONCURRENCY at a time.
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := currentConfig()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var forms []ContactForm
+	if status, msg := decodeJSONBody(w, r, &forms, cfg.MaxBodyBytes*int64(cfg.BatchMaxSize)); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	if len(forms) == 0 {
+		http.Error(w, "Batch is empty", http.StatusBadRequest)
+		return
+	}
+	if len(forms) > cfg.BatchMaxSize {
+		http.Error(w, fmt.Sprintf("Batch too large: at most %d submissions", cfg.BatchMaxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results := make([]batchResult, len(forms))
+	sem := make(chan struct{}, cfg.BatchConcurrency)
+	var wg sync.WaitGroup
+	for i, form := range forms {
+		results[i].Index = i
+		normalizeForm(&form)
+		if errs := validate(form); len(errs) > 0 {
+			results[i].Status = "invalid"
+			results[i].Errors = errs
+			continue
+		}
+		applyFieldDefaults(&form, cfg.FieldDefaults)
+		form.Locale = resolveLocale(cfg, form.Locale, r)
+
+		sub := newSubmission(form)
+		sub.Batch = true
+		results[i].ReferenceID = sub.ID
+		if cfg.Mode == modeLog {
+			logFullSubmission(sub)
+			results[i].Status = "logged"
+			continue
+		}
+		recordSubmission(sub, statusReceived, nil)
+		logSubmission("received via batch", sub)
+		appendToSheet(sub)
+		notifyWebhooks(sub)
+		if cfg.Mode == modeStore {
+			results[i].Status = statusReceived
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			err := deliverSubmission(r.Context(), sub, nil)
+			if errors.Is(err, errDailyCapReached) {
+				results[i].Status = statusCapped
+				return
+			}
+			if errors.Is(err, errMaintenanceMode) {
+				results[i].Status = statusDeferred
+				return
+			}
+			if err != nil {
+				results[i].Status = statusFailed
+				results[i].Error = "Failed to send email"
+				return
+			}
+			results[i].Status = statusSent
+		}()
+	}
+	wg.Wait()
+
+	if auditLog != nil {
+		for _, res := range results {
+			auditLog.write(auditRecord{
+				Time:        time.Now().UTC(),
+				Endpoint:    "batch",
+				ReferenceID: res.ReferenceID,
+				Outcome:     res.Status,
+				FormType:    forms[res.Index].FormType,
+			})
+		}
+	}
+
+	log.Printf("Batch of %d submissions processed", len(forms))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"results": results})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// What happens to submissions from blocked addresses (BLOCKLIST_ACTION)
+const (
+	blockReject = "reject"
+	blockSilent = "silent"
+)
+
+// Read IP_BLOCKLIST_FILE: one address or CIDR per line, # comments
+func loadBlocklist(path string) ([]netip.Prefix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var items []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, line)
+		}
+	}
+	return parsePrefixes(strings.Join(items, ","))
+}
+
+// DNSBL verdicts by address, set up in main when DNSBL_ZONES is set
+var dnsblCache *ttlCache[bool]
+
+// Report why ip is blocked, or "" when it isn't. The static list is
+// checked first; DNSBL lookups fail open so a slow or broken resolver
+// never blocks legitimate visitors.
+func blockedReason(ctx context.Context, cfg *Config, ip netip.Addr) string {
+	if !ip.IsValid() {
+		return ""
+	}
+	if prefixesContain(cfg.Blocklist, ip) {
+		return "IP_BLOCKLIST_FILE"
+	}
+	if len(cfg.DNSBLZones) == 0 || ip.IsLoopback() || ip.IsPrivate() {
+		return ""
+	}
+	key := ip.String()
+	if dnsblCache != nil {
+		if listed, ok := dnsblCache.get(key); ok {
+			return dnsblReason(listed)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.DNSBLTimeout)
+	defer cancel()
+	listed := false
+	for _, zone := range cfg.DNSBLZones {
+		ok, err := dnsblListed(ctx, ip, zone)
+		if err != nil {
+			log.Printf("DNSBL lookup of %s in %s failed: %v", ip, zone, err)
+			// Don't cache a failure as a clean result
+			return ""
+		}
+		if ok {
+			listed = true
+			break
+		}
+	}
+	if dnsblCache != nil {
+		dnsblCache.set(key, listed)
+	}
+	return dnsblReason(listed)
+}
+
+func dnsblReason(listed bool) string {
+	if listed {
+		return "DNSBL"
+	}
+	return ""
+}
+
+// Query <reversed address>.<zone>; listed addresses resolve, normally to
+// 127.0.0.x, and unlisted ones don't exist
+func dnsblListed(ctx context.Context, ip netip.Addr, zone string) (bool, error) {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, dnsblName(ip, zone))
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, a := range addrs {
+		if strings.HasPrefix(a, "127.") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// 192.0.2.1 becomes 1.2.0.192.<zone>; IPv6 addresses are reversed by nibble
+func dnsblName(ip netip.Addr, zone string) string {
+	ip = ip.Unmap()
+	var labels []string
+	if ip.Is4() {
+		b := ip.As4()
+		for i := len(b) - 1; i >= 0; i-- {
+			labels = append(labels, fmt.Sprint(b[i]))
+		}
+	} else {
+		b := ip.As16()
+		for i := len(b) - 1; i >= 0; i-- {
+			labels = append(labels, fmt.Sprintf("%x", b[i]&0xf), fmt.Sprintf("%x", b[i]>>4))
+		}
+	}
+	return strings.Join(labels, ".") + "." + strings.TrimSuffix(zone, ".")
+}
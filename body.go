@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Decode a JSON request body into v, reading at most limit bytes no
+// matter what Content-Length claims. On failure it returns the status
+// and message to answer with, telling apart oversized, empty, truncated
+// and unreadable bodies from plain invalid JSON.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any, limit int64) (int, string) {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	body, err := utf8Body(r)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	err = json.NewDecoder(body).Decode(v)
+	if err == nil {
+		return 0, ""
+	}
+	debugf("Invalid JSON body from %s: %v", r.RemoteAddr, err)
+
+	var (
+		maxErr    *http.MaxBytesError
+		typeErr   *json.UnmarshalTypeError
+		syntaxErr *json.SyntaxError
+	)
+	switch {
+	case errors.As(err, &maxErr):
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body too large: at most %d bytes", maxErr.Limit)
+	case errors.Is(err, io.EOF):
+		return http.StatusBadRequest, "Request body is empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest, "Request body is truncated"
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return http.StatusBadRequest, fmt.Sprintf("Invalid JSON body: field %q must be a %s, got %s",
+			typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value)
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return http.StatusBadRequest, "Invalid JSON body"
+	default:
+		// The connection failed or the proxy cut the body short mid-read
+		return http.StatusBadRequest, "Request body could not be read"
+	}
+}
+
+// The request body as UTF-8. Older integrations declare e.g.
+// charset=ISO-8859-9 in Content-Type; such bodies are transcoded when
+// the charset is one of REQUEST_CHARSETS and refused otherwise.
+func utf8Body(r *http.Request) (io.Reader, error) {
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	label := params["charset"]
+	if label == "" {
+		return r.Body, nil
+	}
+	name, err := charsetName(label)
+	if err != nil || !currentConfig().RequestCharsets[name] {
+		return nil, fmt.Errorf("Unsupported charset %q", label)
+	}
+	if name == "utf-8" {
+		return r.Body, nil
+	}
+	enc, _ := htmlindex.Get(name)
+	return enc.NewDecoder().Reader(r.Body), nil
+}
+
+// Canonical name for a charset label, so aliases such as latin5 and
+// ISO-8859-9 match the same REQUEST_CHARSETS entry
+func charsetName(label string) (string, error) {
+	enc, err := htmlindex.Get(strings.TrimSpace(label))
+	if err != nil {
+		return "", err
+	}
+	return htmlindex.Name(enc)
+}
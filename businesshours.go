@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Weekly opening hours in the display timezone, used to validate
+// requested callback times
+type businessHours struct {
+	days []time.Weekday
+	// Minutes after midnight; a slot must start at or after open and
+	// before close. When close comes first the window runs overnight
+	// into the next day.
+	open, close int
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Parse BUSINESS_DAYS ("mon,tue,...") and BUSINESS_HOURS ("09:00-18:00")
+func parseBusinessHours(days, hours string) (businessHours, error) {
+	var bh businessHours
+	for _, d := range splitList(days) {
+		wd, ok := weekdayNames[strings.ToLower(d)]
+		if !ok {
+			return bh, fmt.Errorf("BUSINESS_DAYS: unknown day %q", d)
+		}
+		bh.days = append(bh.days, wd)
+	}
+	from, to, ok := strings.Cut(hours, "-")
+	if !ok {
+		return bh, fmt.Errorf("BUSINESS_HOURS: want HH:MM-HH:MM, got %q", hours)
+	}
+	var err error
+	if bh.open, err = parseClock(from); err == nil {
+		bh.close, err = parseClock(to)
+	}
+	if err != nil {
+		return bh, fmt.Errorf("BUSINESS_HOURS: %w", err)
+	}
+	if bh.open == bh.close {
+		return bh, fmt.Errorf("BUSINESS_HOURS: %q opens and closes at the same time", hours)
+	}
+	return bh, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Whether t, in its own location, falls in a window. Overnight windows
+// belong to the day they open on.
+func (bh businessHours) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if bh.open < bh.close {
+		return slices.Contains(bh.days, t.Weekday()) && minute >= bh.open && minute < bh.close
+	}
+	if minute >= bh.open {
+		return slices.Contains(bh.days, t.Weekday())
+	}
+	return minute < bh.close && slices.Contains(bh.days, (t.Weekday()+6)%7)
+}
+
+func (bh businessHours) String() string {
+	var names []string
+	for _, d := range bh.days {
+		names = append(names, d.String()[:3])
+	}
+	return fmt.Sprintf("%s %02d:%02d-%02d:%02d", strings.Join(names, ","), bh.open/60, bh.open%60, bh.close/60, bh.close%60)
+}
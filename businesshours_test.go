@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBusinessHours(t *testing.T) {
+	tests := []struct {
+		days, hours string
+		want        string
+		wantErr     bool
+	}{
+		{days: "mon,tue,wed,thu,fri", hours: "09:00-18:00", want: "Mon,Tue,Wed,Thu,Fri 09:00-18:00"},
+		{days: "Sat, Sun", hours: " 10:30 - 14:00 ", want: "Sat,Sun 10:30-14:00"},
+		{days: "fri", hours: "22:00-06:00", want: "Fri 22:00-06:00"},
+		{days: "mon,funday", hours: "09:00-18:00", wantErr: true},
+		{days: "mon", hours: "09:00", wantErr: true},
+		{days: "mon", hours: "9am-5pm", wantErr: true},
+		{days: "mon", hours: "25:00-26:00", wantErr: true},
+		{days: "mon", hours: "09:00-09:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.days+" "+tt.hours, func(t *testing.T) {
+			bh, err := parseBusinessHours(tt.days, tt.hours)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && bh.String() != tt.want {
+				t.Errorf("String() = %q, want %q", bh.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestBusinessHoursContains(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := func(value string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", value, berlin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	// An instant, shown in Berlin time the way callbackTime checks it
+	utc := func(value string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.In(berlin)
+	}
+
+	tests := []struct {
+		name        string
+		days, hours string
+		at          time.Time
+		want        bool
+	}{
+		{"opening minute", "mon,tue,wed,thu,fri", "09:00-18:00", local("2026-10-14 09:00"), true},
+		{"closing minute", "mon,tue,wed,thu,fri", "09:00-18:00", local("2026-10-14 18:00"), false},
+		{"weekend", "mon,tue,wed,thu,fri", "09:00-18:00", local("2026-10-17 12:00"), false},
+		// Clocks go forward on 29 March and back on 25 October 2026
+		{"16:30 UTC before spring DST", "mon,tue,wed,thu,fri", "09:00-18:00", utc("2026-03-27 16:30"), true},
+		{"16:30 UTC after spring DST", "mon,tue,wed,thu,fri", "09:00-18:00", utc("2026-03-30 16:30"), false},
+		{"07:30 UTC before autumn DST", "mon,tue,wed,thu,fri", "09:00-18:00", utc("2026-10-23 07:30"), true},
+		{"07:30 UTC after autumn DST", "mon,tue,wed,thu,fri", "09:00-18:00", utc("2026-10-26 07:30"), false},
+		{"overnight evening", "mon,tue,wed,thu,fri", "22:00-06:00", local("2026-10-12 23:00"), true},
+		{"overnight next morning", "mon,tue,wed,thu,fri", "22:00-06:00", local("2026-10-13 05:59"), true},
+		{"overnight into the weekend", "mon,tue,wed,thu,fri", "22:00-06:00", local("2026-10-17 05:00"), true},
+		{"overnight from a closed day", "mon,tue,wed,thu,fri", "22:00-06:00", local("2026-10-12 05:00"), false},
+		{"overnight closing minute", "mon,tue,wed,thu,fri", "22:00-06:00", local("2026-10-13 06:00"), false},
+		{"overnight daytime", "mon,tue,wed,thu,fri", "22:00-06:00", local("2026-10-13 12:00"), false},
+		{"overnight across spring DST", "sat", "22:00-06:00", utc("2026-03-29 03:30"), true},
+		{"overnight after spring DST close", "sat", "22:00-06:00", utc("2026-03-29 04:15"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bh, err := parseBusinessHours(tt.days, tt.hours)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bh.contains(tt.at); got != tt.want {
+				t.Errorf("contains(%s) = %v, want %v", tt.at.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
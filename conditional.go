@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// A field that becomes required depending on another one. With Equals
+// set the condition is an exact match on When's value; without it, When
+// merely has to be filled in.
+type requiredWhen struct {
+	Field  string  `json:"field"`
+	When   string  `json:"when"`
+	Equals *string `json:"equals"`
+}
+
+// Fields conditions may refer to: everything that is normalized plus the
+// form type
+func conditionFields(f *ContactForm) map[string]*string {
+	fields := normalizedFields(f)
+	fields["formType"] = &f.FormType
+	return fields
+}
+
+// Parse REQUIRED_WHEN, a JSON list such as
+// [{"field": "phone", "when": "formType", "equals": "callback"}]
+func parseRequiredWhen(raw string) ([]requiredWhen, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var rules []requiredWhen
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, err
+	}
+	known := conditionFields(&ContactForm{})
+	for _, r := range rules {
+		if _, ok := known[r.Field]; !ok || r.Field == "formType" {
+			return nil, fmt.Errorf("unknown field %q", r.Field)
+		}
+		if _, ok := known[r.When]; !ok {
+			return nil, fmt.Errorf("unknown field %q", r.When)
+		}
+	}
+	return rules, nil
+}
+
+func (r requiredWhen) applies(form *ContactForm) bool {
+	v := *conditionFields(form)[r.When]
+	if r.Equals == nil {
+		return v != ""
+	}
+	return v == *r.Equals
+}
+
+func (r requiredWhen) message() string {
+	if r.Equals == nil {
+		return "is required when " + r.When + " is given"
+	}
+	return fmt.Sprintf("is required when %s is %q", r.When, *r.Equals)
+}
+
+// Message for the first REQUIRED_WHEN rule that makes an empty field
+// required, or ""
+func requiredByCondition(field string, form *ContactForm) string {
+	for _, r := range currentConfig().RequiredWhen {
+		if r.Field == field && r.applies(form) {
+			return r.message()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,1083 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	// Embedded zoneinfo for minimal containers without /usr/share/zoneinfo
+	_ "time/tzdata"
+)
+
+// Runtime configuration, loaded in main and swapped by /reload
+var activeConfig atomic.Pointer[Config]
+
+// The configuration in effect; callers handling a request should read it
+// once and keep the snapshot
+func currentConfig() *Config {
+	return activeConfig.Load()
+}
+
+// What happens to accepted submissions (MODE)
+const (
+	modeEmail = "email" // store and email to the team
+	modeStore = "store" // store only
+	modeLog   = "log"   // write to the log only
+)
+
+// Deployment environments selected by APP_ENV
+const (
+	envDevelopment = "development"
+	envStaging     = "staging"
+	envProduction  = "production"
+)
+
+const defaultAllowedOrigins = "http://localhost:3000,https://next-kiosk.com,https://next-kiosk.netlify.app,http://next-kiosk.netlify.app"
+
+// Config holds the settings read from the environment and CONFIG_FILE
+type Config struct {
+	// Raw CONFIG_FILE values, kept to report what a reload changed
+	values map[string]string
+
+	// development, staging or production; drives the defaults below.
+	// Empty when APP_ENV is unset, which keeps the lenient non-production
+	// behaviour of deployments from before APP_ENV existed.
+	AppEnv string
+	// Log extra detail about each request
+	Verbose bool
+	// Log composed emails instead of sending them
+	MailDryRun bool
+	// Serve /api/contact/synthetic for load tests (read at startup); not
+	// allowed in production or while mail is really sent
+	SyntheticEndpoint bool
+	// email, store or log; see modeEmail
+	Mode string
+
+	// Bearer token for operational endpoints; they are off when empty
+	AdminToken string
+	// Browser origins allowed to call the API; "*" allows any origin and
+	// requires CORSCredentials to be off
+	AllowedOrigins []string
+	// Send Access-Control-Allow-Credentials so browsers include cookies
+	CORSCredentials bool
+
+	// Use X-Forwarded-For from the reverse proxy for the client IP
+	TrustProxy bool
+	// Client networks that skip captcha verification (QA, office)
+	CaptchaBypass []netip.Prefix
+	// Form fields (JSON names) hashed or masked in submission logs;
+	// hashes are keyed with LogRedactKey, or a per-process random key
+	// when it is unset, so they stay stable across restarts only with it
+	LogRedactFields map[string]bool
+	LogRedactMode   string
+	LogRedactKey    string
+	// Addresses to refuse, from IP_BLOCKLIST_FILE and DNSBL_ZONES lookups
+	// (cached for DNSBLCacheTTL, read at startup); BlocklistAction is
+	// reject (403) or silent (fake success)
+	Blocklist       []netip.Prefix
+	DNSBLZones      []string
+	DNSBLTimeout    time.Duration
+	DNSBLCacheTTL   time.Duration
+	BlocklistAction string
+	// Reject emails whose domain can't receive mail (CHECK_MX), with
+	// lookups cached for MXCacheTTL (read at startup)
+	CheckMX    bool
+	MXTimeout  time.Duration
+	MXCacheTTL time.Duration
+	// Reject emails whose top-level domain isn't delegated (CHECK_TLD)
+	// or, when EMAIL_TLDS lists any, isn't one of those; see
+	// emailTLDAllowed
+	CheckTLD  bool
+	EmailTLDs map[string]bool
+	// ERROR_FORMAT: json ({"status":"error"}) or problem (RFC 7807
+	// application/problem+json), or the deprecated text; clients can
+	// still ask for either, or for text/plain, via Accept
+	ErrorFormat string
+	// SUCCESS_RESPONSE: standard or compact payload for successful
+	// submissions, see successBody
+	SuccessResponse string
+	// Words not accepted in names and messages, from PROFANITY_WORDS and
+	// PROFANITY_WORDS_FILE, lower-cased; the filter is off when empty.
+	// ProfanityAction is reject (400), drop (fake success) or flag.
+	ProfanityWords  map[string]bool
+	ProfanityAction string
+	// Reject markup and NUL bytes in form fields
+	StrictFields bool
+	// Accepted values for the optional budget field
+	BudgetOptions []string
+	// Lead scoring, see leadPriority: off while LeadPriorityThreshold is
+	// 0. LeadBudgetMin is one of BudgetOptions, which are listed from
+	// smallest to largest; FreeEmailDomains holds lower-cased domains.
+	LeadPriorityThreshold int
+	LeadBudgetMin         string
+	LeadMessageMin        int
+	FreeEmailDomains      map[string]bool
+	// Largest accepted request body; batches may be BatchMaxSize times this
+	MaxBodyBytes int64
+	// Charsets request bodies may declare, by canonical name (see
+	// charsetName); they are transcoded to UTF-8 before decoding
+	RequestCharsets map[string]bool
+	// multipart/form-data uploads: files per submission (0 rejects
+	// multipart bodies), size per file and for all files together, and
+	// how much of a file is buffered in memory before spooling to disk
+	AttachmentMaxFiles      int
+	AttachmentMaxBytes      int64
+	AttachmentMaxTotalBytes int64
+	AttachmentMemoryBytes   int64
+	// Accepted file extensions (lower case, no dot) and the media types
+	// their content and declared type may have, from ATTACHMENT_TYPES
+	AttachmentTypes map[string][]string
+	// Normalization steps per form field, keyed by JSON name
+	Normalize map[string][]string
+	// Maximum length in characters per form field, keyed by JSON name
+	MaxLengths map[string]int
+
+	SMTPEmail       string
+	SMTPPassword    string
+	RecaptchaSecret string
+	// MAIL FROM address, where bounces go; defaults to SMTPEmail
+	SMTPEnvelopeFrom string
+	// Key for signing form tokens; form tokens are off when empty.
+	// Submissions faster than FormMinFillTime or slower than
+	// FormMaxFillTime (0 for no limit) are silently dropped. With
+	// FormTokenRequired a missing, forged, expired or reused token is
+	// refused with 403 instead; read at startup.
+	FormTokenSecret   string
+	FormMinFillTime   time.Duration
+	FormMaxFillTime   time.Duration
+	FormTokenRequired bool
+	// AUTH mechanism: plain, login or cram-md5
+	SMTPAuth string
+	// Relays tried in order until one accepts the connection and login,
+	// from SMTP_SERVERS; see parseSMTPServers
+	SMTPServers []smtpServer
+	// Limit for connecting to a server, TLS and login
+	SMTPTimeout time.Duration
+	// While others remain, a server that just failed is skipped this long
+	SMTPFailoverCooldown time.Duration
+	// Name announced in EHLO/HELO; relays may check it against reverse DNS
+	SMTPHeloHost string
+	// Idle connections kept open for reuse; 0 dials per send. Read at startup.
+	SMTPPoolSize int
+	// Pooled connections idle longer than this are reopened
+	SMTPPoolIdleTimeout time.Duration
+	// Domains the SMTP account may use in From aliases
+	SMTPFromDomains []string
+	// siteverify endpoint, overridable for regional endpoints and tests
+	RecaptchaVerifyURL string
+	// Limit for each siteverify or assessment call. Read at startup.
+	RecaptchaTimeout time.Duration
+	// RECAPTCHA_MODE=enterprise verifies tokens with an assessment in
+	// the Google Cloud project instead of siteverify, authenticated by
+	// API key; RecaptchaSecret is unused then
+	RecaptchaMode          string
+	RecaptchaProjectID     string
+	RecaptchaAPIKey        string
+	RecaptchaSiteKey       string
+	RecaptchaEnterpriseURL string
+	// How long a used token is remembered to reject replays
+	RecaptchaReplayWindow time.Duration
+	// Tokens solved longer ago than this are rejected as expired
+	RecaptchaMaxTokenAge time.Duration
+	// Scores must exceed this to pass
+	RecaptchaMinScore float64
+	// Concurrent siteverify calls allowed (0 = unbounded, read at
+	// startup). Others wait up to RecaptchaQueueTimeout, and beyond
+	// RecaptchaMaxWaiting waiters (0 = no limit) are refused with a 503.
+	RecaptchaMaxConcurrent int
+	RecaptchaMaxWaiting    int
+	RecaptchaQueueTimeout  time.Duration
+	// Minimum time before any /api/contact response, plus random jitter;
+	// 0 disables the delay
+	ResponseMinDelay    time.Duration
+	ResponseDelayJitter time.Duration
+	// How long a successful Idempotency-Key is replayed; 0 disables
+	IdempotencyWindow time.Duration
+
+	// Notifications sent per day before submissions are only stored; 0 is
+	// unlimited. Capped requests get DailySendCapStatus, 200 or 503, and
+	// are sent by the retry worker once the day rolls over.
+	DailySendCap       int
+	DailySendCapStatus int
+
+	// Valid submissions allowed per client IP and per email in each
+	// window; 0, the default, disables rate limiting
+	RateLimit       int
+	RateLimitWindow time.Duration
+	// Tighter limit for scores at or below RateLimitStrictScore, at most
+	// RateLimit (2 by default, or RateLimit when that is lower)
+	RateLimitStrict      int
+	RateLimitStrictScore float64
+	// CAPTCHA_STEP_UP makes the limit soft: past it the frontend is told
+	// to re-challenge (429 with code captcha_step_up), and submissions
+	// scoring above CaptchaStepUpScore pass, up to RateLimitHard per
+	// window (three times RateLimit by default, 0 = no ceiling)
+	CaptchaStepUp      bool
+	CaptchaStepUpScore float64
+	RateLimitHard      int
+	// /api/verify-captcha calls allowed per client IP in each
+	// RateLimitWindow, whether or not submissions are rate limited; 0
+	// lifts the limit
+	VerifyCaptchaRateLimit int
+
+	// Timezone for email Date headers and timestamps in bodies
+	DisplayLocation *time.Location
+	// When callbacks may be requested, in DisplayLocation
+	BusinessHours businessHours
+	// Company signature appended to outgoing emails; omitted when empty
+	EmailFooter string
+	// Transfer encoding for text bodies that aren't plain 7-bit ASCII:
+	// quoted-printable or base64
+	MailBodyEncoding string
+	// Column at which notification text is wrapped; 0 leaves lines as
+	// they are
+	MailWrapColumn int
+	// Locales offered to submitters and the fallback when none match
+	SupportedLocales []string
+	DefaultLocale    string
+	// Brand logo embedded in HTML emails; plain text only when nil
+	Logo *inlinePart
+	// Directory of HTML template overrides, parsed at startup and again
+	// on every change with EMAIL_TEMPLATE_WATCH
+	EmailTemplateDir   string
+	EmailTemplateWatch bool
+	// Keys notification emails are PGP/MIME encrypted to; plaintext when
+	// nil. Subjects stay readable, so keep subject templates free of PII.
+	PGPKeys openpgp.EntityList
+
+	// Where submissions without a known form type go
+	DefaultRoute *FormRoute
+	// Per form type recipient and subject overrides
+	FormTypes map[string]*FormRoute
+	// Per site replacements for the default route, keyed by Origin
+	OriginRoutes map[string]*FormRoute
+	// Recipients chosen by keywords in the message, on top of the form
+	// route, see keywordRecipients. KeywordMatch is first or all,
+	// KeywordAction replace (the route's recipients) or cc.
+	KeywordRoutes []*keywordRoute
+	KeywordMatch  string
+	KeywordAction string
+	// Fields required only when another field has a given value
+	RequiredWhen []requiredWhen
+	// Values for fields left empty, keyed by JSON name, applied after
+	// validation
+	FieldDefaults map[string]string
+	// Test inbox that receives all mail instead of the real recipients
+	OverrideRecipient string
+
+	// Optional URL of a newline-separated disposable domain list
+	DisposableDomainsURL string
+	// How often the disposable domain list is re-fetched
+	DisposableDomainsRefresh time.Duration
+	// Directory for submission records; in-memory when empty
+	SubmissionsDir string
+	// Send a confirmation with the reference ID to the submitter
+	AutoReply bool
+	// Answer 202 once a submission is validated and stored, sending from
+	// a queue of SendQueueSize; the outcome is polled on
+	// /api/contact/status/{id}. Needs SUBMISSIONS_DIR; read at startup.
+	AsyncSend     bool
+	SendQueueSize int
+	// Hold submissions this long after the first one from a sender and
+	// send their follow-ups in one notification, answering 202 with
+	// ASYNC_SEND and the usual success otherwise; 0 sends each right
+	// away. Needs SUBMISSIONS_DIR; read at startup.
+	MergeWindow time.Duration
+	// SMTP sends slower than this are logged as warnings
+	SlowSendThreshold time.Duration
+	// How long in-memory submission records are kept
+	SubmissionRetention time.Duration
+	// Partner keys for /api/contact/batch, which is disabled when empty
+	BatchAPIKeys []string
+	// Keys allowing /api/contact?validate=true dry runs for synthetic
+	// monitoring, sent in X-API-Key
+	MonitorAPIKeys []string
+	// Submissions accepted per batch request and sent in parallel
+	BatchMaxSize     int
+	BatchConcurrency int
+	// JSON-lines audit file, rotated past AuditLogMaxBytes keeping
+	// AuditLogKeep old files; off when empty
+	AuditLogFile     string
+	AuditLogMaxBytes int64
+	AuditLogKeep     int
+	// Failed submissions are resent every RetryInterval, waiting
+	// RetryBackoff (doubling per attempt) since the last try, at most
+	// RetryMaxAttempts times; with 0 attempts, the default, the worker
+	// only sends submissions deferred by maintenance mode
+	RetryInterval    time.Duration
+	RetryBackoff     time.Duration
+	RetryMaxAttempts int
+	// How often expired entries are swept from in-memory stores
+	CleanupInterval time.Duration
+	// Store submissions without emailing them, answering with
+	// MaintenanceMessage; they go out once this is switched off again,
+	// e.g. via /reload
+	MaintenanceMode    bool
+	MaintenanceMessage string
+	// Time allowed on shutdown for in-flight requests and then queued
+	// sends; checked between sends, so one slow send can run over
+	ShutdownTimeout time.Duration
+	// Serve HTTPS with this certificate and key when both are set, for
+	// deployments without a TLS-terminating proxy. Read at startup.
+	TLSCertFile string
+	TLSKeyFile  string
+	// http.Server limits, read at startup. ReadHeaderTimeout stops
+	// clients trickling headers to hold connections open; WriteTimeout
+	// must cover a synchronous send. 0 means no limit.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	KeepAlive         bool
+
+	// Google Sheets lead tracking; disabled unless the sheet ID is set
+	SheetsCredentialsFile string
+	SheetsID              string
+	SheetsRange           string
+
+	// Endpoints each submission is POSTed to as JSON; off when empty.
+	// Failures are retried WebhookMaxAttempts times in all, waiting
+	// WebhookBackoff (doubling) between tries, then written to
+	// WebhookDeadLetterFile. Queue size is read at startup.
+	WebhookURLs           []string
+	WebhookTimeout        time.Duration
+	WebhookMaxAttempts    int
+	WebhookBackoff        time.Duration
+	WebhookQueueSize      int
+	WebhookDeadLetterFile string
+}
+
+func loadConfig() (*Config, error) {
+	env := &envReader{}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		values, err := readEnvFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("CONFIG_FILE: %w", err)
+		}
+		env.file = values
+	}
+
+	appEnv := env.str("APP_ENV", "")
+	dev := appEnv == envDevelopment
+	// Production only accepts clearly human scores by default
+	minScore := 0.5
+	if appEnv == envProduction {
+		minScore = 0.7
+	}
+	// Past the soft limit, captcha step-ups get up to three times as many
+	rateLimit := env.int("RATE_LIMIT", 0)
+
+	cfg := &Config{
+		values: env.file,
+
+		AppEnv:     appEnv,
+		Verbose:    env.bool("LOG_VERBOSE", dev),
+		MailDryRun: env.bool("MAIL_DRY_RUN", dev),
+		Mode:       env.str("MODE", modeEmail),
+
+		SyntheticEndpoint: env.bool("SYNTHETIC_ENDPOINT", false),
+
+		AdminToken:      env.str("ADMIN_TOKEN", ""),
+		AllowedOrigins:  splitList(env.str("ALLOWED_ORIGINS", defaultAllowedOrigins)),
+		CORSCredentials: env.bool("CORS_ALLOW_CREDENTIALS", true),
+
+		TrustProxy:    env.bool("TRUST_PROXY", false),
+		CaptchaBypass: env.prefixes("CAPTCHA_BYPASS_IPS"),
+
+		DNSBLZones:      splitList(env.str("DNSBL_ZONES", "")),
+		DNSBLTimeout:    env.duration("DNSBL_TIMEOUT", 2*time.Second),
+		DNSBLCacheTTL:   env.duration("DNSBL_CACHE_TTL", time.Hour),
+		BlocklistAction: strings.ToLower(env.str("BLOCKLIST_ACTION", blockReject)),
+		CheckMX:         env.bool("CHECK_MX", false),
+		MXTimeout:       env.duration("MX_TIMEOUT", 2*time.Second),
+		MXCacheTTL:      env.duration("MX_CACHE_TTL", time.Hour),
+		ProfanityAction: strings.ToLower(env.str("PROFANITY_ACTION", profanityReject)),
+		ErrorFormat:     strings.ToLower(env.str("ERROR_FORMAT", errorFormatJSON)),
+		SuccessResponse: strings.ToLower(env.str("SUCCESS_RESPONSE", successShapeStandard)),
+
+		CheckTLD:  env.bool("CHECK_TLD", false),
+		EmailTLDs: map[string]bool{},
+
+		StrictFields:  env.bool("STRICT_FIELD_VALIDATION", false),
+		BudgetOptions: splitList(env.str("BUDGET_OPTIONS", "<10k,10k-50k,>50k")),
+		MaxBodyBytes:  int64(env.int("MAX_BODY_BYTES", 64<<10)),
+
+		LeadPriorityThreshold: env.int("LEAD_PRIORITY_THRESHOLD", 0),
+		LeadBudgetMin:         env.str("LEAD_BUDGET_MIN", ""),
+		LeadMessageMin:        env.int("LEAD_MESSAGE_MIN", 300),
+		FreeEmailDomains:      wordSet(splitList(env.str("LEAD_FREE_EMAIL_DOMAINS", defaultFreeEmailDomains))),
+
+		AttachmentMaxFiles:      env.int("ATTACHMENT_MAX_FILES", 0),
+		AttachmentMaxBytes:      int64(env.int("ATTACHMENT_MAX_BYTES", 5<<20)),
+		AttachmentMaxTotalBytes: int64(env.int("ATTACHMENT_MAX_TOTAL_BYTES", 10<<20)),
+		AttachmentMemoryBytes:   int64(env.int("ATTACHMENT_MEMORY_BYTES", 1<<20)),
+
+		SMTPEmail:       env.str("SMTP_EMAIL", ""),
+		SMTPPassword:    env.str("SMTP_PASSWORD", ""),
+		RecaptchaSecret: env.str("RECAPTCHA_SECRET", ""),
+		// FORM_TIMING_SECRET is the name from before tokens were required
+		FormTokenSecret:       env.str("FORM_TOKEN_SECRET", env.str("FORM_TIMING_SECRET", "")),
+		FormTokenRequired:     env.bool("FORM_TOKEN_REQUIRED", false),
+		FormMinFillTime:       env.duration("FORM_MIN_FILL_TIME", 2*time.Second),
+		FormMaxFillTime:       env.duration("FORM_MAX_FILL_TIME", 24*time.Hour),
+		SMTPAuth:              strings.ToLower(env.str("SMTP_AUTH", smtpAuthPlain)),
+		SMTPHeloHost:          env.str("SMTP_HELO_HOST", "next-kiosk.com"),
+		SMTPPoolSize:          env.int("SMTP_POOL_SIZE", 0),
+		SMTPPoolIdleTimeout:   env.duration("SMTP_POOL_IDLE_TIMEOUT", time.Minute),
+		SMTPTimeout:           env.duration("SMTP_TIMEOUT", 10*time.Second),
+		SMTPFailoverCooldown:  env.duration("SMTP_FAILOVER_COOLDOWN", 30*time.Second),
+		RecaptchaVerifyURL:    env.str("RECAPTCHA_VERIFY_URL", defaultRecaptchaVerifyURL),
+		RecaptchaReplayWindow: env.duration("RECAPTCHA_REPLAY_WINDOW", 10*time.Minute),
+		RecaptchaTimeout:      env.duration("RECAPTCHA_TIMEOUT", 10*time.Second),
+		RecaptchaMinScore:     env.float("RECAPTCHA_MIN_SCORE", minScore),
+		RecaptchaMaxTokenAge:  env.duration("RECAPTCHA_MAX_TOKEN_AGE", 2*time.Minute),
+		IdempotencyWindow:     env.duration("IDEMPOTENCY_WINDOW", 24*time.Hour),
+		ResponseMinDelay:      env.duration("RESPONSE_MIN_DELAY", 0),
+		ResponseDelayJitter:   env.duration("RESPONSE_DELAY_JITTER", 0),
+
+		RecaptchaMaxConcurrent: env.int("RECAPTCHA_MAX_CONCURRENT", 0),
+		RecaptchaMaxWaiting:    env.int("RECAPTCHA_MAX_WAITING", 0),
+		RecaptchaQueueTimeout:  env.duration("RECAPTCHA_QUEUE_TIMEOUT", 2*time.Second),
+
+		RecaptchaMode:          strings.ToLower(env.str("RECAPTCHA_MODE", recaptchaModeClassic)),
+		RecaptchaProjectID:     env.str("RECAPTCHA_PROJECT_ID", ""),
+		RecaptchaAPIKey:        env.str("RECAPTCHA_API_KEY", ""),
+		RecaptchaSiteKey:       env.str("RECAPTCHA_SITE_KEY", ""),
+		RecaptchaEnterpriseURL: env.str("RECAPTCHA_ENTERPRISE_URL", defaultRecaptchaEnterpriseURL),
+
+		DailySendCap:       env.int("DAILY_SEND_CAP", 0),
+		DailySendCapStatus: env.int("DAILY_SEND_CAP_STATUS", http.StatusOK),
+
+		RateLimit:            rateLimit,
+		RateLimitWindow:      env.duration("RATE_LIMIT_WINDOW", time.Hour),
+		RateLimitStrict:      env.int("RATE_LIMIT_STRICT", min(2, rateLimit)),
+		RateLimitStrictScore: env.float("RATE_LIMIT_STRICT_SCORE", 0.7),
+		CaptchaStepUp:        env.bool("CAPTCHA_STEP_UP", false),
+		CaptchaStepUpScore:   env.float("CAPTCHA_STEP_UP_SCORE", 0.9),
+		RateLimitHard:        env.int("RATE_LIMIT_HARD", 3*rateLimit),
+
+		VerifyCaptchaRateLimit: env.int("VERIFY_CAPTCHA_RATE_LIMIT", 20),
+
+		DefaultRoute: &FormRoute{
+			Recipient: env.str("CONTACT_RECIPIENT", "info@next-kiosk.com"),
+			Subject:   env.str("CONTACT_SUBJECT", defaultSubject),
+			From:      env.str("CONTACT_FROM", ""),
+
+			RecaptchaAction: env.str("RECAPTCHA_ACTION", ""),
+		},
+
+		DisposableDomainsURL:     env.str("DISPOSABLE_DOMAINS_URL", ""),
+		DisposableDomainsRefresh: env.duration("DISPOSABLE_DOMAINS_REFRESH", 24*time.Hour),
+		SubmissionsDir:           env.str("SUBMISSIONS_DIR", ""),
+		AutoReply:                env.bool("AUTO_REPLY_ENABLED", false),
+		AsyncSend:                env.bool("ASYNC_SEND", false),
+		SendQueueSize:            env.int("SEND_QUEUE_SIZE", 100),
+		MergeWindow:              env.duration("MERGE_WINDOW", 0),
+		SlowSendThreshold:        env.duration("SMTP_SLOW_SEND_THRESHOLD", 10*time.Second),
+		SubmissionRetention:      env.duration("SUBMISSION_RETENTION", 7*24*time.Hour),
+		CleanupInterval:          env.duration("CLEANUP_INTERVAL", time.Minute),
+		ShutdownTimeout:          env.duration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		TLSCertFile:              env.str("TLS_CERT_FILE", ""),
+		TLSKeyFile:               env.str("TLS_KEY_FILE", ""),
+		ReadHeaderTimeout:        env.duration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:              env.duration("HTTP_READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:             env.duration("HTTP_WRITE_TIMEOUT", time.Minute),
+		IdleTimeout:              env.duration("HTTP_IDLE_TIMEOUT", 2*time.Minute),
+		KeepAlive:                env.bool("HTTP_KEEP_ALIVE", true),
+		MaintenanceMode:          env.bool("MAINTENANCE_MODE", false),
+		MaintenanceMessage:       env.str("MAINTENANCE_MESSAGE", "Thanks, we have received your message and will process it shortly."),
+		AuditLogFile:             env.str("AUDIT_LOG_FILE", ""),
+		AuditLogMaxBytes:         int64(env.int("AUDIT_LOG_MAX_BYTES", 10<<20)),
+		AuditLogKeep:             env.int("AUDIT_LOG_KEEP", 5),
+		BatchAPIKeys:             splitList(env.str("BATCH_API_KEYS", "")),
+		MonitorAPIKeys:           splitList(env.str("MONITOR_API_KEYS", "")),
+		BatchMaxSize:             env.int("BATCH_MAX_SIZE", 100),
+		BatchConcurrency:         env.int("BATCH_CONCURRENCY", 4),
+		RetryInterval:            env.duration("RETRY_INTERVAL", 5*time.Minute),
+		RetryBackoff:             env.duration("RETRY_BACKOFF", time.Minute),
+		RetryMaxAttempts:         env.int("RETRY_MAX_ATTEMPTS", 0),
+
+		SheetsCredentialsFile: env.str("GOOGLE_SHEETS_CREDENTIALS_FILE", ""),
+		SheetsID:              env.str("GOOGLE_SHEETS_ID", ""),
+		SheetsRange:           env.str("GOOGLE_SHEETS_RANGE", "Sheet1!A:L"),
+
+		WebhookURLs:           splitList(env.str("WEBHOOK_URLS", "")),
+		WebhookTimeout:        env.duration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookMaxAttempts:    env.int("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookBackoff:        env.duration("WEBHOOK_BACKOFF", 30*time.Second),
+		WebhookQueueSize:      env.int("WEBHOOK_QUEUE_SIZE", 100),
+		WebhookDeadLetterFile: env.str("WEBHOOK_DEAD_LETTER_FILE", ""),
+	}
+
+	nameLen := env.int("MAX_LENGTH_NAME", 100)
+	cfg.MaxLengths = map[string]int{
+		"firstName": nameLen,
+		"lastName":  nameLen,
+		"email":     env.int("MAX_LENGTH_EMAIL", 254),
+		"phone":     env.int("MAX_LENGTH_PHONE", 30),
+		"company":   env.int("MAX_LENGTH_COMPANY", 200),
+		"message":   env.int("MAX_LENGTH_MESSAGE", 5000),
+	}
+	for _, f := range []string{"utmSource", "utmMedium", "utmCampaign"} {
+		cfg.MaxLengths[f] = env.int("MAX_LENGTH_UTM", 100)
+	}
+
+	// Conservative defaults: only whitespace trimming and lower-case email
+	cfg.Normalize = map[string][]string{}
+	for _, n := range []struct{ field, key, def string }{
+		{"firstName", "NORMALIZE_FIRST_NAME", "trim"},
+		{"lastName", "NORMALIZE_LAST_NAME", "trim"},
+		{"email", "NORMALIZE_EMAIL", "trim,lower"},
+		{"phone", "NORMALIZE_PHONE", "trim"},
+		{"company", "NORMALIZE_COMPANY", "trim"},
+		{"budget", "NORMALIZE_BUDGET", "trim"},
+		{"message", "NORMALIZE_MESSAGE", "trim"},
+		{"preferredTime", "NORMALIZE_PREFERRED_TIME", "trim"},
+		{"utmSource", "NORMALIZE_UTM", "trim"},
+		{"utmMedium", "NORMALIZE_UTM", "trim"},
+		{"utmCampaign", "NORMALIZE_UTM", "trim"},
+	} {
+		steps, err := parseNormalizers(env.str(n.key, n.def))
+		if err != nil {
+			env.fail("%s: %w", n.key, err)
+		}
+		cfg.Normalize[n.field] = steps
+	}
+
+	cfg.LogRedactFields = map[string]bool{}
+	for _, f := range splitList(env.str("LOG_REDACT_FIELDS", "firstName,lastName,email,phone")) {
+		cfg.LogRedactFields[f] = true
+	}
+	cfg.LogRedactMode = env.str("LOG_REDACT_MODE", redactHash)
+	cfg.LogRedactKey = env.str("LOG_REDACT_KEY", "")
+	if cfg.LogRedactMode != redactHash && cfg.LogRedactMode != redactMask {
+		env.fail("LOG_REDACT_MODE must be %q or %q", redactHash, redactMask)
+	}
+
+	for _, l := range splitList(env.str("SUPPORTED_LOCALES", "en,tr")) {
+		chain := localeChain(l)
+		if len(chain) == 0 {
+			env.fail("SUPPORTED_LOCALES: invalid locale %q", l)
+			continue
+		}
+		cfg.SupportedLocales = append(cfg.SupportedLocales, chain[0])
+	}
+	cfg.DefaultLocale = env.str("DEFAULT_LOCALE", "en")
+	if chain := localeChain(cfg.DefaultLocale); len(chain) > 0 {
+		cfg.DefaultLocale = chain[0]
+	}
+	if !slices.Contains(cfg.SupportedLocales, cfg.DefaultLocale) {
+		env.fail("DEFAULT_LOCALE %q is not in SUPPORTED_LOCALES", cfg.DefaultLocale)
+	}
+
+	cfg.DisplayLocation = loadDisplayLocation(env.str("TZ_DISPLAY", "UTC"))
+	if bh, err := parseBusinessHours(env.str("BUSINESS_DAYS", "mon,tue,wed,thu,fri"), env.str("BUSINESS_HOURS", "09:00-18:00")); err != nil {
+		env.fail("%w", err)
+	} else {
+		cfg.BusinessHours = bh
+	}
+	cfg.EmailFooter = env.str("EMAIL_FOOTER", "")
+	if path := env.str("EMAIL_FOOTER_FILE", ""); path != "" {
+		if data, err := os.ReadFile(path); err != nil {
+			env.fail("EMAIL_FOOTER_FILE: %w", err)
+		} else {
+			cfg.EmailFooter = string(data)
+		}
+	}
+	cfg.EmailFooter = strings.TrimSpace(cfg.EmailFooter)
+	switch cfg.MailBodyEncoding = strings.ToLower(env.str("MAIL_BODY_ENCODING", encodingQuotedPrintable)); cfg.MailBodyEncoding {
+	case encodingQuotedPrintable, encodingBase64:
+	default:
+		env.fail("MAIL_BODY_ENCODING must be quoted-printable or base64")
+	}
+	if cfg.MailWrapColumn = env.int("MAIL_WRAP_COLUMN", 78); cfg.MailWrapColumn < 0 {
+		env.fail("MAIL_WRAP_COLUMN must not be negative")
+	}
+	cfg.EmailTemplateDir = env.str("EMAIL_TEMPLATE_DIR", "")
+	cfg.EmailTemplateWatch = env.bool("EMAIL_TEMPLATE_WATCH", false)
+	if cfg.EmailTemplateWatch && cfg.EmailTemplateDir == "" {
+		env.fail("EMAIL_TEMPLATE_WATCH requires EMAIL_TEMPLATE_DIR")
+	}
+	if path := env.str("EMAIL_LOGO_PATH", ""); path != "" {
+		if logo, err := loadLogo(path); err != nil {
+			env.fail("EMAIL_LOGO_PATH: %w", err)
+		} else {
+			cfg.Logo = logo
+		}
+	}
+	if path := env.str("PGP_PUBLIC_KEY_FILE", ""); path != "" {
+		if keys, err := loadPGPKeys(path); err != nil {
+			env.fail("PGP_PUBLIC_KEY_FILE: %w", err)
+		} else {
+			cfg.PGPKeys = keys
+		}
+	}
+	cfg.OverrideRecipient = env.str("OVERRIDE_RECIPIENT", "")
+	if cfg.OverrideRecipient != "" {
+		if _, err := mail.ParseAddress(cfg.OverrideRecipient); err != nil {
+			env.fail("OVERRIDE_RECIPIENT: %w", err)
+		}
+	}
+	cfg.SMTPEnvelopeFrom = env.str("SMTP_ENVELOPE_FROM", cfg.SMTPEmail)
+	if cfg.SMTPEnvelopeFrom != cfg.SMTPEmail {
+		if addr, err := mail.ParseAddress(cfg.SMTPEnvelopeFrom); err != nil || addr.Address != cfg.SMTPEnvelopeFrom {
+			env.fail("SMTP_ENVELOPE_FROM must be a bare address")
+		}
+	}
+	cfg.SMTPFromDomains = splitList(env.str("SMTP_ALLOWED_FROM_DOMAINS", ""))
+	if len(cfg.SMTPFromDomains) == 0 && strings.Contains(cfg.SMTPEmail, "@") {
+		cfg.SMTPFromDomains = []string{emailDomain(cfg.SMTPEmail)}
+	}
+	if err := cfg.DefaultRoute.compile("CONTACT_SUBJECT", cfg.SMTPFromDomains); err != nil {
+		env.fail("%w", err)
+	}
+	if routes, err := parseFormRoutes(env.str("FORM_TYPES", ""), cfg.SMTPFromDomains); err != nil {
+		env.fail("FORM_TYPES: %w", err)
+	} else {
+		cfg.FormTypes = routes
+	}
+	if routes, err := parseFormRoutes(env.str("ORIGIN_ROUTES", ""), cfg.SMTPFromDomains); err != nil {
+		env.fail("ORIGIN_ROUTES: %w", err)
+	} else {
+		// Submissions only carry an origin listed in ALLOWED_ORIGINS, so a
+		// route for any other would never match; "*" doesn't count
+		for origin := range routes {
+			if err := validOrigin(origin); err != nil {
+				env.fail("ORIGIN_ROUTES: %w", err)
+			} else if !slices.Contains(cfg.AllowedOrigins, origin) {
+				env.fail("ORIGIN_ROUTES: %s must be listed in ALLOWED_ORIGINS", origin)
+			}
+		}
+		cfg.OriginRoutes = routes
+	}
+	if routes, err := parseKeywordRoutes(env.str("KEYWORD_ROUTES", "")); err != nil {
+		env.fail("KEYWORD_ROUTES: %w", err)
+	} else {
+		cfg.KeywordRoutes = routes
+	}
+	if cfg.KeywordMatch = strings.ToLower(env.str("KEYWORD_ROUTE_MATCH", keywordMatchFirst)); cfg.KeywordMatch != keywordMatchFirst && cfg.KeywordMatch != keywordMatchAll {
+		env.fail("KEYWORD_ROUTE_MATCH must be first or all")
+	}
+	if cfg.KeywordAction = strings.ToLower(env.str("KEYWORD_ROUTE_ACTION", keywordActionReplace)); cfg.KeywordAction != keywordActionReplace && cfg.KeywordAction != keywordActionCc {
+		env.fail("KEYWORD_ROUTE_ACTION must be replace or cc")
+	}
+	if rules, err := parseRequiredWhen(env.str("REQUIRED_WHEN", "")); err != nil {
+		env.fail("REQUIRED_WHEN: %w", err)
+	} else {
+		cfg.RequiredWhen = rules
+	}
+	if defaults, err := parseFieldDefaults(env.str("FIELD_DEFAULTS", "")); err != nil {
+		env.fail("FIELD_DEFAULTS: %w", err)
+	} else {
+		cfg.FieldDefaults = defaults
+	}
+
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" {
+			if cfg.CORSCredentials {
+				env.fail("ALLOWED_ORIGINS: \"*\" requires CORS_ALLOW_CREDENTIALS=false")
+			}
+			continue
+		}
+		if err := validOrigin(o); err != nil {
+			env.fail("ALLOWED_ORIGINS: %w", err)
+		}
+	}
+
+	switch cfg.Mode {
+	case modeEmail, modeStore, modeLog:
+	default:
+		env.fail("MODE: unknown mode %q", cfg.Mode)
+	}
+
+	switch cfg.AppEnv {
+	case "", envDevelopment, envStaging, envProduction:
+	default:
+		env.fail("APP_ENV: unknown environment %q", cfg.AppEnv)
+	}
+	if cfg.SyntheticEndpoint && cfg.AppEnv != envDevelopment && cfg.AppEnv != envStaging {
+		env.fail("SYNTHETIC_ENDPOINT requires APP_ENV=development or staging")
+	}
+	if cfg.SyntheticEndpoint && cfg.Mode == modeEmail && !cfg.MailDryRun {
+		env.fail("SYNTHETIC_ENDPOINT requires MAIL_DRY_RUN=true when MODE=email")
+	}
+	// Those would pass fake leads on to real systems
+	if cfg.SyntheticEndpoint && (len(cfg.WebhookURLs) > 0 || cfg.SheetsID != "") {
+		env.fail("SYNTHETIC_ENDPOINT is not allowed with WEBHOOK_URLS or GOOGLE_SHEETS_ID")
+	}
+	if cfg.SyntheticEndpoint && cfg.AdminToken == "" {
+		env.fail("SYNTHETIC_ENDPOINT requires ADMIN_TOKEN")
+	}
+	if cfg.DisposableDomainsRefresh <= 0 {
+		env.fail("DISPOSABLE_DOMAINS_REFRESH must be positive")
+	}
+	if cfg.SheetsID != "" && cfg.SheetsCredentialsFile == "" {
+		env.fail("GOOGLE_SHEETS_ID requires GOOGLE_SHEETS_CREDENTIALS_FILE")
+	}
+	if (cfg.RateLimit > 0 || cfg.VerifyCaptchaRateLimit > 0) && cfg.RateLimitWindow <= 0 {
+		env.fail("RATE_LIMIT_WINDOW must be positive")
+	}
+	if cfg.CaptchaStepUp && (cfg.CaptchaStepUpScore < cfg.RecaptchaMinScore || cfg.CaptchaStepUpScore >= 1) {
+		env.fail("CAPTCHA_STEP_UP_SCORE must be at least RECAPTCHA_MIN_SCORE and below 1")
+	}
+	if cfg.RateLimit > 0 && (cfg.RateLimitStrict <= 0 || cfg.RateLimitStrict > cfg.RateLimit) {
+		env.fail("RATE_LIMIT_STRICT must be between 1 and RATE_LIMIT")
+	}
+	if cfg.RateLimitHard < 0 || cfg.RateLimitHard > 0 && cfg.RateLimitHard < cfg.RateLimit {
+		env.fail("RATE_LIMIT_HARD must be 0 or at least RATE_LIMIT")
+	}
+	switch cfg.SMTPAuth {
+	case smtpAuthPlain, smtpAuthLogin, smtpAuthCRAMMD5:
+	default:
+		env.fail("SMTP_AUTH: unknown mechanism %q", cfg.SMTPAuth)
+	}
+	if servers, err := parseSMTPServers(env.str("SMTP_SERVERS", ""), cfg); err != nil {
+		env.fail("SMTP_SERVERS: %w", err)
+	} else {
+		cfg.SMTPServers = servers
+	}
+	if cfg.SMTPHeloHost == "" || strings.ContainsAny(cfg.SMTPHeloHost, " \t\r\n") {
+		env.fail("SMTP_HELO_HOST must be a single hostname")
+	}
+	if cfg.DailySendCapStatus != http.StatusOK && cfg.DailySendCapStatus != http.StatusServiceUnavailable {
+		env.fail("DAILY_SEND_CAP_STATUS must be 200 or 503")
+	}
+	if cfg.RecaptchaTimeout <= 0 {
+		env.fail("RECAPTCHA_TIMEOUT must be positive")
+	}
+	if cfg.SMTPTimeout <= 0 || cfg.SMTPFailoverCooldown < 0 {
+		env.fail("SMTP_TIMEOUT must be positive and SMTP_FAILOVER_COOLDOWN not negative")
+	}
+	if cfg.SMTPPoolSize < 0 {
+		env.fail("SMTP_POOL_SIZE must not be negative")
+	}
+	if cfg.SMTPPoolSize > 0 && cfg.SMTPPoolIdleTimeout <= 0 {
+		env.fail("SMTP_POOL_IDLE_TIMEOUT must be positive")
+	}
+	if cfg.ResponseMinDelay < 0 || cfg.ResponseDelayJitter < 0 {
+		env.fail("RESPONSE_MIN_DELAY and RESPONSE_DELAY_JITTER must not be negative")
+	}
+	if cfg.AuditLogFile != "" && (cfg.AuditLogMaxBytes < 0 || cfg.AuditLogKeep < 1) {
+		env.fail("AUDIT_LOG_MAX_BYTES must not be negative and AUDIT_LOG_KEEP must be at least 1")
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		env.fail("MAX_BODY_BYTES must be positive")
+	}
+	if cfg.RecaptchaMode != recaptchaModeClassic && cfg.RecaptchaMode != recaptchaModeEnterprise {
+		env.fail("RECAPTCHA_MODE must be classic or enterprise")
+	}
+	if cfg.RecaptchaMaxConcurrent < 0 || cfg.RecaptchaMaxWaiting < 0 {
+		env.fail("RECAPTCHA_MAX_CONCURRENT and RECAPTCHA_MAX_WAITING must not be negative")
+	}
+	if cfg.RecaptchaMaxConcurrent > 0 && cfg.RecaptchaQueueTimeout <= 0 {
+		env.fail("RECAPTCHA_QUEUE_TIMEOUT must be positive")
+	}
+	if cfg.AttachmentMaxFiles < 0 {
+		env.fail("ATTACHMENT_MAX_FILES must not be negative")
+	}
+	if cfg.AttachmentMaxFiles > 0 && (cfg.AttachmentMaxBytes <= 0 || cfg.AttachmentMaxTotalBytes < cfg.AttachmentMaxBytes || cfg.AttachmentMemoryBytes < 0) {
+		env.fail("ATTACHMENT_MAX_BYTES must be positive and at most ATTACHMENT_MAX_TOTAL_BYTES")
+	}
+	if types, err := parseAttachmentTypes(env.str("ATTACHMENT_TYPES", defaultAttachmentTypes)); err != nil {
+		env.fail("ATTACHMENT_TYPES: %w", err)
+	} else {
+		cfg.AttachmentTypes = types
+	}
+	if cfg.BatchMaxSize <= 0 || cfg.BatchConcurrency <= 0 {
+		env.fail("BATCH_MAX_SIZE and BATCH_CONCURRENCY must be positive")
+	}
+	if cfg.RetryInterval <= 0 || cfg.RetryMaxAttempts > 0 && cfg.RetryBackoff <= 0 {
+		env.fail("RETRY_INTERVAL and RETRY_BACKOFF must be positive")
+	}
+	if cfg.FormTokenRequired && (cfg.FormTokenSecret == "" || cfg.FormMaxFillTime <= 0) {
+		env.fail("FORM_TOKEN_REQUIRED needs FORM_TOKEN_SECRET and a positive FORM_MAX_FILL_TIME")
+	}
+	if cfg.FormMinFillTime < 0 || cfg.FormMaxFillTime < 0 || cfg.FormMaxFillTime > 0 && cfg.FormMaxFillTime <= cfg.FormMinFillTime {
+		env.fail("FORM_MAX_FILL_TIME must be longer than FORM_MIN_FILL_TIME")
+	}
+	for _, u := range cfg.WebhookURLs {
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			env.fail("WEBHOOK_URLS: %q is not an http(s) URL", u)
+		}
+	}
+	if len(cfg.WebhookURLs) > 0 && (cfg.WebhookMaxAttempts < 1 || cfg.WebhookBackoff <= 0 || cfg.WebhookQueueSize <= 0 || cfg.WebhookTimeout <= 0) {
+		env.fail("WEBHOOK_MAX_ATTEMPTS, WEBHOOK_BACKOFF, WEBHOOK_QUEUE_SIZE and WEBHOOK_TIMEOUT must be positive")
+	}
+	if cfg.CleanupInterval <= 0 {
+		env.fail("CLEANUP_INTERVAL must be positive")
+	}
+	words := splitList(env.str("PROFANITY_WORDS", ""))
+	if path := env.str("PROFANITY_WORDS_FILE", ""); path != "" {
+		if list, err := loadWordList(path); err != nil {
+			env.fail("PROFANITY_WORDS_FILE: %w", err)
+		} else {
+			words = append(words, list...)
+		}
+	}
+	cfg.ProfanityWords = wordSet(words)
+	switch cfg.ProfanityAction {
+	case profanityReject, profanityDrop, profanityFlag:
+	default:
+		env.fail("PROFANITY_ACTION must be reject, drop or flag")
+	}
+	if path := env.str("IP_BLOCKLIST_FILE", ""); path != "" {
+		if list, err := loadBlocklist(path); err != nil {
+			env.fail("IP_BLOCKLIST_FILE: %w", err)
+		} else {
+			cfg.Blocklist = list
+		}
+	}
+	cfg.RequestCharsets = map[string]bool{}
+	for _, label := range splitList(env.str("REQUEST_CHARSETS", "utf-8,iso-8859-1,iso-8859-9,windows-1252")) {
+		if name, err := charsetName(label); err != nil {
+			env.fail("REQUEST_CHARSETS: unknown charset %q", label)
+		} else {
+			cfg.RequestCharsets[name] = true
+		}
+	}
+	if cfg.LeadPriorityThreshold < 0 || cfg.LeadMessageMin < 0 {
+		env.fail("LEAD_PRIORITY_THRESHOLD and LEAD_MESSAGE_MIN must not be negative")
+	}
+	if cfg.LeadBudgetMin != "" && !slices.Contains(cfg.BudgetOptions, cfg.LeadBudgetMin) {
+		env.fail("LEAD_BUDGET_MIN must be one of BUDGET_OPTIONS")
+	}
+	switch cfg.ErrorFormat {
+	case errorFormatJSON, errorFormatProblem:
+	case errorFormatText:
+		log.Println("ERROR_FORMAT=text is deprecated, clients asking for text/plain get plain errors with json too")
+	default:
+		env.fail("ERROR_FORMAT must be json or problem")
+	}
+	if cfg.SuccessResponse != successShapeStandard && cfg.SuccessResponse != successShapeCompact {
+		env.fail("SUCCESS_RESPONSE must be standard or compact")
+	}
+	if cfg.BlocklistAction != blockReject && cfg.BlocklistAction != blockSilent {
+		env.fail("BLOCKLIST_ACTION must be reject or silent")
+	}
+	for _, tld := range splitList(env.str("EMAIL_TLDS", "")) {
+		tld = strings.ToLower(strings.TrimPrefix(tld, "."))
+		if !knownTLD(tld) {
+			env.fail("EMAIL_TLDS: %q is not a known top-level domain", tld)
+		}
+		cfg.EmailTLDs[tld] = true
+	}
+	if cfg.CheckMX && (cfg.MXTimeout <= 0 || cfg.MXCacheTTL <= 0) {
+		env.fail("MX_TIMEOUT and MX_CACHE_TTL must be positive")
+	}
+	if len(cfg.DNSBLZones) > 0 && (cfg.DNSBLTimeout <= 0 || cfg.DNSBLCacheTTL <= 0) {
+		env.fail("DNSBL_TIMEOUT and DNSBL_CACHE_TTL must be positive")
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		env.fail("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	} else if cfg.TLSCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+			env.fail("TLS_CERT_FILE: %w", err)
+		}
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		env.fail("SHUTDOWN_TIMEOUT must be positive")
+	}
+	if cfg.ReadHeaderTimeout < 0 || cfg.ReadTimeout < 0 || cfg.WriteTimeout < 0 || cfg.IdleTimeout < 0 {
+		env.fail("HTTP_READ_HEADER_TIMEOUT, HTTP_READ_TIMEOUT, HTTP_WRITE_TIMEOUT and HTTP_IDLE_TIMEOUT must not be negative")
+	}
+	if cfg.AsyncSend && cfg.SendQueueSize <= 0 {
+		env.fail("SEND_QUEUE_SIZE must be positive")
+	}
+	// What is still queued at shutdown is only kept for a resend in
+	// SUBMISSIONS_DIR
+	if cfg.AsyncSend && cfg.Mode == modeEmail && cfg.SubmissionsDir == "" {
+		env.fail("ASYNC_SEND requires SUBMISSIONS_DIR")
+	}
+	if cfg.MergeWindow > 0 && cfg.Mode == modeEmail && cfg.SubmissionsDir == "" {
+		env.fail("MERGE_WINDOW requires SUBMISSIONS_DIR")
+	}
+	if cfg.MergeWindow < 0 {
+		env.fail("MERGE_WINDOW must not be negative")
+	}
+
+	// Production must never come up half-configured; SMTP is only needed
+	// when submissions are emailed
+	if cfg.AppEnv == envProduction {
+		required := recaptchaCredentials(cfg)
+		if cfg.Mode == modeEmail {
+			required["SMTP_EMAIL"] = cfg.SMTPEmail
+			required["SMTP_PASSWORD"] = cfg.SMTPPassword
+		}
+		var missing []string
+		for key, v := range required {
+			if v == "" {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			env.fail("production requires %s", strings.Join(missing, ", "))
+		}
+		// Strict captcha: every submission is verified
+		if len(cfg.CaptchaBypass) > 0 {
+			env.fail("CAPTCHA_BYPASS_IPS is not allowed with APP_ENV=production")
+		}
+	}
+
+	// The partially loaded config is returned with the error so -check
+	// can report on everything else
+	return cfg, env.err()
+}
+
+// Load an IANA zone, falling back to UTC so a typo never blocks startup
+func loadDisplayLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("TZ_DISPLAY %q could not be loaded, using UTC: %v", name, err)
+		return time.UTC
+	}
+	return loc
+}
+
+// envReader reads typed values from CONFIG_FILE and the environment,
+// collecting parse errors so every bad variable is reported at once.
+// Values from the file take precedence so they can be changed by /reload.
+// Secrets may instead name a file holding the value in KEY_FILE, as with
+// Docker and Kubernetes secrets; the file wins over the plain variable.
+type envReader struct {
+	file map[string]string
+	errs []error
+}
+
+func (e *envReader) lookup(key string) string {
+	if isSecretKey(key) {
+		if path := e.raw(key + "_FILE"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				e.fail("%s_FILE: %w", key, err)
+				return ""
+			}
+			return strings.TrimRight(string(data), "\r\n")
+		}
+	}
+	return e.raw(key)
+}
+
+func (e *envReader) raw(key string) string {
+	if v, ok := e.file[key]; ok {
+		return v
+	}
+	return os.Getenv(key)
+}
+
+func (e *envReader) fail(format string, args ...any) {
+	e.errs = append(e.errs, fmt.Errorf(format, args...))
+}
+
+func (e *envReader) err() error {
+	return errors.Join(e.errs...)
+}
+
+func (e *envReader) str(key, def string) string {
+	if v := e.lookup(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func (e *envReader) prefixes(key string) []netip.Prefix {
+	p, err := parsePrefixes(e.lookup(key))
+	if err != nil {
+		e.fail("%s: %w", key, err)
+	}
+	return p
+}
+
+func (e *envReader) bool(key string, def bool) bool {
+	v := e.lookup(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.fail("%s: %w", key, err)
+		return def
+	}
+	return b
+}
+
+func (e *envReader) int(key string, def int) int {
+	v := e.lookup(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.fail("%s: %w", key, err)
+		return def
+	}
+	return n
+}
+
+func (e *envReader) float(key string, def float64) float64 {
+	v := e.lookup(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.fail("%s: %w", key, err)
+		return def
+	}
+	return f
+}
+
+func (e *envReader) duration(key string, def time.Duration) time.Duration {
+	v := e.lookup(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.fail("%s: %w", key, err)
+		return def
+	}
+	return d
+}
+
+// Parse a KEY=VALUE file in the usual .env format: blank lines and
+// # comments are skipped, an "export " prefix is allowed and values may
+// be wrapped in single or double quotes.
+func readEnvFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, i+1)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	return values, nil
+}
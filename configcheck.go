@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// One line of the configuration report
+type configCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type configReport struct {
+	OK     bool          `json:"ok"`
+	Checks []configCheck `json:"checks"`
+}
+
+func (r *configReport) add(name string, err error) {
+	c := configCheck{Name: name, OK: err == nil}
+	if err != nil {
+		c.Detail = err.Error()
+		r.OK = false
+	}
+	r.Checks = append(r.Checks, c)
+}
+
+// Validate the loaded configuration without sending mail. loadErr is the
+// error loadConfig returned alongside cfg, if any.
+func checkConfig(cfg *Config, loadErr error) configReport {
+	rep := configReport{OK: true}
+	rep.add("load", loadErr)
+	if cfg == nil {
+		return rep
+	}
+
+	if cfg.Mode == modeEmail {
+		rep.add("smtp_credentials", requireSet(map[string]string{
+			"SMTP_EMAIL":    cfg.SMTPEmail,
+			"SMTP_PASSWORD": cfg.SMTPPassword,
+		}))
+	}
+	if cfg.SMTPEmail != "" {
+		_, err := mail.ParseAddress(cfg.SMTPEmail)
+		rep.add("smtp_email", err)
+	}
+	rep.add("recaptcha_secret", requireSet(recaptchaCredentials(cfg)))
+
+	rep.add("recipients", checkRoutes(cfg, func(name string, fr *FormRoute) error {
+		for _, addr := range splitList(fr.Recipient) {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return fmt.Errorf("%s: %q: %w", name, addr, err)
+			}
+		}
+		return nil
+	}))
+	rep.add("templates", checkRoutes(cfg, func(name string, fr *FormRoute) error {
+		if fr.subject == nil {
+			return fmt.Errorf("%s: subject not compiled", name)
+		}
+		if _, err := fr.renderSubject(sampleMailData()); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if fr.autoReply != nil {
+			if _, _, err := fr.renderAutoReply(sampleMailData()); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	}))
+	rep.add("allowed_origins", checkOrigins(cfg.AllowedOrigins))
+
+	return rep
+}
+
+func requireSet(values map[string]string) error {
+	var missing []string
+	for key, v := range values {
+		if v == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+}
+
+func checkRoutes(cfg *Config, fn func(name string, fr *FormRoute) error) error {
+	if cfg.DefaultRoute == nil {
+		return fmt.Errorf("no default route")
+	}
+	if err := fn("default", cfg.DefaultRoute); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(cfg.FormTypes))
+	for name := range cfg.FormTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fn(name, cfg.FormTypes[name]); err != nil {
+			return err
+		}
+	}
+	origins := make([]string, 0, len(cfg.OriginRoutes))
+	for origin := range cfg.OriginRoutes {
+		origins = append(origins, origin)
+	}
+	sort.Strings(origins)
+	for _, origin := range origins {
+		if err := fn(origin, cfg.OriginRoutes[origin]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkOrigins(origins []string) error {
+	if len(origins) == 0 {
+		return fmt.Errorf("no allowed origins")
+	}
+	for _, o := range origins {
+		if o == "*" {
+			continue
+		}
+		if err := validOrigin(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// An origin is scheme://host[:port] with nothing else
+func validOrigin(o string) error {
+	u, err := url.Parse(o)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return fmt.Errorf("invalid origin %q", o)
+	}
+	return nil
+}
+
+// Representative values used to trial-render templates
+func sampleMailData() mailData {
+	return mailData{
+		ContactForm: ContactForm{
+			FirstName: "Jane",
+			LastName:  "Doe",
+			Email:     "jane@example.com",
+			Phone:     "+90 555 000 0000",
+			Company:   "Example Ltd",
+			Message:   "Hello",
+		},
+		Ref: "ABCD2345",
+	}
+}
+
+func configCheckHandler(w http.ResponseWriter, r *http.Request) {
+	rep := checkConfig(currentConfig(), nil)
+	w.Header().Set("Content-Type", "application/json")
+	if !rep.OK {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(rep)
+}
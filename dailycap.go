@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var errDailyCapReached = errors.New("daily send cap reached")
+
+// Notifications sent today, counted against DAILY_SEND_CAP. The day
+// rolls over at midnight in the display timezone (TZ_DISPLAY).
+type dailyCounter struct {
+	mu     sync.Mutex
+	day    string
+	count  int
+	capped bool
+}
+
+var dailySends = &dailyCounter{}
+
+// Count one send, reporting false once limit sends were already made
+// today. A limit of 0 means no cap.
+func (d *dailyCounter) take(limit int, now time.Time) bool {
+	if limit <= 0 {
+		return true
+	}
+	day := localTime(now).Format(time.DateOnly)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if day != d.day {
+		d.day, d.count, d.capped = day, 0, false
+	}
+	if d.count >= limit {
+		if !d.capped {
+			log.Printf("Daily send cap of %d reached, further submissions are stored and sent by the retry worker after midnight", limit)
+			d.capped = true
+		}
+		return false
+	}
+	d.count++
+	return true
+}
+
+// Whether limit sends were already made today, without counting one
+func (d *dailyCounter) reached(limit int, now time.Time) bool {
+	if limit <= 0 {
+		return false
+	}
+	day := localTime(now).Format(time.DateOnly)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return day == d.day && d.count >= limit
+}
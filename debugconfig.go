@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// Effective configuration of the running process (GET /debug/config,
+// admin only), defaults included. Credentials are shown as "***" when
+// set, and webhook URLs count as credentials since they often embed one.
+func debugConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(effectiveConfig(currentConfig()))
+}
+
+func effectiveConfig(cfg *Config) map[string]any {
+	v := reflect.ValueOf(cfg).Elem()
+	out := map[string]any{}
+	for i := range v.NumField() {
+		f := v.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		out[f.Name] = displayField(f.Name, v.Field(i))
+	}
+	return out
+}
+
+func isSecretField(name string) bool {
+	for _, suffix := range []string{"Password", "Secret", "Token", "APIKey", "APIKeys"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return name == "WebhookURLs"
+}
+
+// JSON-friendly form of one field: durations and zones as text, keys and
+// the logo summarized rather than dumped
+func displayField(name string, field reflect.Value) any {
+	if isSecretField(name) {
+		if field.IsZero() || field.Kind() == reflect.Slice && field.Len() == 0 {
+			return ""
+		}
+		return "***"
+	}
+	switch v := field.Interface().(type) {
+	case time.Duration:
+		return v.String()
+	case *time.Location:
+		return v.String()
+	case businessHours:
+		return v.String()
+	case *inlinePart:
+		if v == nil {
+			return nil
+		}
+		return v.Filename
+	case []smtpServer:
+		servers := []string{}
+		for _, s := range v {
+			servers = append(servers, s.Username+"@"+s.addr())
+		}
+		return servers
+	case openpgp.EntityList:
+		fingerprints := []string{}
+		for _, e := range v {
+			fingerprints = append(fingerprints, strings.ToUpper(hex.EncodeToString(e.PrimaryKey.Fingerprint)))
+		}
+		return fingerprints
+	default:
+		return v
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Parse FIELD_DEFAULTS, a JSON object of values for fields left empty,
+// e.g. {"company": "Next Kiosk", "utmSource": "website"}. Defaults come
+// from the operator, so they aren't run through the field checks.
+func parseFieldDefaults(raw string) (map[string]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var defaults map[string]string
+	if err := json.Unmarshal([]byte(raw), &defaults); err != nil {
+		return nil, err
+	}
+	known := conditionFields(&ContactForm{})
+	for field := range defaults {
+		if _, ok := known[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+	}
+	return defaults, nil
+}
+
+// Fill empty fields from FIELD_DEFAULTS. This runs after validation, so
+// required fields never get a default and one can't stand in for a
+// value REQUIRED_WHEN asks the submitter for.
+func applyFieldDefaults(form *ContactForm, defaults map[string]string) {
+	fields := conditionFields(form)
+	for field, v := range defaults {
+		if p := fields[field]; *p == "" {
+			*p = v
+		}
+	}
+}
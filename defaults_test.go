@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFieldDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "unset", raw: ""},
+		{name: "known fields", raw: `{"company": "Next Kiosk", "utmSource": "website"}`, want: map[string]string{"company": "Next Kiosk", "utmSource": "website"}},
+		{name: "form type", raw: `{"formType": "contact"}`, want: map[string]string{"formType": "contact"}},
+		{name: "unknown field", raw: `{"favouriteColour": "blue"}`, wantErr: true},
+		{name: "not an object", raw: `["company"]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFieldDefaults(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyFieldDefaults(t *testing.T) {
+	form := ContactForm{Company: "Acme GmbH"}
+	applyFieldDefaults(&form, map[string]string{"company": "Next Kiosk", "utmSource": "website"})
+	if form.Company != "Acme GmbH" || form.UTMSource != "website" {
+		t.Errorf("got company %q, utmSource %q", form.Company, form.UTMSource)
+	}
+}
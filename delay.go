@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Hold every response until at least RESPONSE_MIN_DELAY (plus up to
+// RESPONSE_DELAY_JITTER) after the request arrived, so a fast validation
+// error can't be told apart from a slow reCAPTCHA rejection by latency.
+// Responses that already took longer are not delayed further.
+func minDelayMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := currentConfig()
+		if cfg.ResponseMinDelay <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		until := time.Now().Add(cfg.ResponseMinDelay)
+		if cfg.ResponseDelayJitter > 0 {
+			until = until.Add(rand.N(cfg.ResponseDelayJitter))
+		}
+		dw := &delayedWriter{ResponseWriter: w, r: r, until: until}
+		next.ServeHTTP(dw, r)
+		dw.wait()
+	})
+}
+
+// Blocks the first header or body write until the deadline
+type delayedWriter struct {
+	http.ResponseWriter
+	r     *http.Request
+	until time.Time
+	once  sync.Once
+}
+
+func (d *delayedWriter) wait() {
+	d.once.Do(func() {
+		t := time.NewTimer(time.Until(d.until))
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-d.r.Context().Done():
+		}
+	})
+}
+
+func (d *delayedWriter) WriteHeader(code int) {
+	d.wait()
+	d.ResponseWriter.WriteHeader(code)
+}
+
+func (d *delayedWriter) Write(b []byte) (int, error) {
+	d.wait()
+	return d.ResponseWriter.Write(b)
+}
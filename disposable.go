@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Fallback list used when no URL is configured or the fetch fails
+var bundledDisposableDomains = []string{
+	"10minutemail.com",
+	"20minutemail.com",
+	"33mail.com",
+	"anonbox.net",
+	"dispostable.com",
+	"emailondeck.com",
+	"fakeinbox.com",
+	"getairmail.com",
+	"getnada.com",
+	"guerrillamail.biz",
+	"guerrillamail.com",
+	"guerrillamail.de",
+	"guerrillamail.info",
+	"guerrillamail.net",
+	"guerrillamail.org",
+	"guerrillamailblock.com",
+	"harakirimail.com",
+	"incognitomail.org",
+	"jetable.org",
+	"mail-temp.com",
+	"mailcatch.com",
+	"maildrop.cc",
+	"mailinator.com",
+	"mailinator.net",
+	"mailnesia.com",
+	"mintemail.com",
+	"moakt.com",
+	"mohmal.com",
+	"mytemp.email",
+	"mytrashmail.com",
+	"sharklasers.com",
+	"spamgourmet.com",
+	"temp-mail.io",
+	"temp-mail.org",
+	"tempail.com",
+	"tempinbox.com",
+	"tempmail.com",
+	"tempmail.net",
+	"tempmailo.com",
+	"tempr.email",
+	"throwawaymail.com",
+	"trashmail.com",
+	"trashmail.de",
+	"trashmail.net",
+	"yopmail.com",
+	"yopmail.fr",
+	"yopmail.net",
+}
+
+// In-memory set of disposable domains, swapped on every refresh
+type domainList struct {
+	mu      sync.RWMutex
+	domains map[string]struct{}
+}
+
+var disposableDomains = newDomainList(bundledDisposableDomains)
+
+func newDomainList(domains []string) *domainList {
+	l := &domainList{}
+	l.set(domains)
+	return l
+}
+
+func (l *domainList) set(domains []string) {
+	m := make(map[string]struct{}, len(domains))
+	for _, d := range domains {
+		m[strings.ToLower(d)] = struct{}{}
+	}
+	l.mu.Lock()
+	l.domains = m
+	l.mu.Unlock()
+}
+
+// contains reports whether domain or any of its parent domains is listed
+func (l *domainList) contains(domain string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	domain = strings.ToLower(domain)
+	for {
+		if _, ok := l.domains[domain]; ok {
+			return true
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			return false
+		}
+		domain = domain[i+1:]
+	}
+}
+
+func isDisposableEmail(email string) bool {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return false
+	}
+	return disposableDomains.contains(email[at+1:])
+}
+
+// Fetch the remote list now and then on every tick until ctx is
+// cancelled. On failure the previous list (initially the bundled one)
+// stays in place.
+func refreshDisposableDomains(ctx context.Context, url string, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		domains, err := fetchDomainList(url)
+		if err != nil {
+			log.Println("Disposable domain list fetch failed:", err)
+		} else {
+			disposableDomains.set(append(domains, bundledDisposableDomains...))
+			log.Printf("Loaded %d disposable domains from %s", len(domains), url)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Upper bound for a fetched list; the common public ones are well under 1 MiB
+const maxDomainListSize = 8 << 20
+
+func fetchDomainList(url string) ([]string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	// A truncated list could end in a cut-off name that blocks a real domain
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDomainListSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDomainListSize {
+		return nil, fmt.Errorf("list is larger than %d bytes", maxDomainListSize)
+	}
+	return parseDomainList(bytes.NewReader(data))
+}
+
+// One lower-cased domain per line, skipping # comments. Entries that
+// aren't a registrable hostname are skipped and counted in the log: since
+// contains walks parent domains, a stray "com" or "co.uk" would block
+// every address under it.
+func parseDomainList(r io.Reader) ([]string, error) {
+	var domains []string
+	skipped := 0
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.ToLower(strings.TrimSpace(sc.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !listableDomain(line) {
+			skipped++
+			continue
+		}
+		domains = append(domains, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		log.Printf("Disposable domain list: skipped %d invalid entries", skipped)
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("list is empty")
+	}
+	return domains, nil
+}
+
+// Whether d is a syntactically valid hostname below a public suffix
+func listableDomain(d string) bool {
+	if len(d) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(d, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	_, err := publicsuffix.EffectiveTLDPlusOne(d)
+	return err == nil
+}
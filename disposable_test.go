@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDomainList(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "comments and blank lines", list: "# disposable\n\nmailinator.com\n  yopmail.fr  \n", want: []string{"mailinator.com", "yopmail.fr"}},
+		{name: "lower-cased", list: "GuerrillaMail.COM\n", want: []string{"guerrillamail.com"}},
+		{name: "subdomains kept", list: "mail.tempmail.co.uk\n", want: []string{"mail.tempmail.co.uk"}},
+		{name: "public suffixes skipped", list: "com\nco.uk\ntrashmail.de\n", want: []string{"trashmail.de"}},
+		{name: "malformed entries skipped", list: "-bad.com\nbad-.com\nsp ace.com\n*.wild.com\na..b.com\nhttp://x.com\nok.net\n", want: []string{"ok.net"}},
+		{name: "nothing valid", list: "com\n# only a comment\n", wantErr: true},
+		{name: "empty", list: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDomainList(strings.NewReader(tt.list))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
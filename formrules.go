@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const formRulesHeader = "X-Form-Rules"
+
+// One field's constraints as the frontend needs them
+type fieldSummary struct {
+	Field     string   `json:"field"`
+	Required  bool     `json:"required,omitempty"`
+	MaxLength int      `json:"maxLength,omitempty"`
+	Options   []string `json:"options,omitempty"`
+}
+
+type formRulesSummary struct {
+	Fields       []fieldSummary `json:"fields"`
+	RequiredWhen []requiredWhen `json:"requiredWhen,omitempty"`
+}
+
+// Describe formRules under cfg. A field is required when one of its
+// checks already fails on an empty value.
+func summarizeFormRules(cfg *Config) formRulesSummary {
+	var s formRulesSummary
+	for _, rule := range formRules {
+		f := fieldSummary{Field: rule.field, MaxLength: cfg.MaxLengths[rule.field]}
+		for _, c := range rule.checks {
+			if c("") != "" {
+				f.Required = true
+			}
+		}
+		if rule.field == "budget" {
+			f.Options = cfg.BudgetOptions
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	s.RequiredWhen = cfg.RequiredWhen
+	return s
+}
+
+// Put the contact form's rules, JSON-encoded, in X-Form-Rules on OPTIONS
+// responses. Scripts can't read the browser's automatic preflight, so the
+// frontend sends its own OPTIONS request and reads the exposed header.
+func formRulesMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			var b strings.Builder
+			enc := json.NewEncoder(&b)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(summarizeFormRules(currentConfig())); err != nil {
+				log.Println("Form rules encode error:", err)
+			} else {
+				w.Header().Set(formRulesHeader, strings.TrimSpace(b.String()))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
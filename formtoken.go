@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Form tokens record when the form was rendered, signed with
+// FORM_TOKEN_SECRET so the timestamp comes from our clock rather than
+// the visitor's. The format is "<unix millis>.<nonce>.<base64url
+// HMAC-SHA256>"; the nonce makes each token unique so it can be spent
+// only once.
+
+func signFormToken(secret string, at time.Time) string {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	payload := strconv.FormatInt(at.UnixMilli(), 10) + "." + base64.RawURLEncoding.EncodeToString(nonce)
+	return payload + "." + formTokenMAC(secret, payload)
+}
+
+func formTokenMAC(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+var (
+	errFormTokenInvalid = errors.New("missing or invalid form token")
+	errFormTokenExpired = errors.New("form token expired")
+	errFormTokenReused  = errors.New("form token already used")
+)
+
+// Nonces of tokens already spent, set up in main when FORM_TOKEN_SECRET
+// is set; entries outlive the tokens they belong to
+var spentFormTokens *ttlCache[struct{}]
+
+// Check a form token and the time between rendering and submission.
+// Tokens older than FORM_MAX_FILL_TIME are expired; ones presented
+// sooner than FORM_MIN_FILL_TIME fail with a plain error. A token
+// passing every check is spent here when spentFormTokens is set; hand
+// it back with releaseFormToken if the submission is then rejected.
+func checkFormToken(cfg *Config, token string, now time.Time) error {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 || !hmac.Equal([]byte(token[i+1:]), []byte(formTokenMAC(cfg.FormTokenSecret, token[:i]))) {
+		return errFormTokenInvalid
+	}
+	ts, nonce, _ := strings.Cut(token[:i], ".")
+	ms, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || nonce == "" {
+		return errFormTokenInvalid
+	}
+	elapsed := now.Sub(time.UnixMilli(ms))
+	switch {
+	case cfg.FormMaxFillTime > 0 && elapsed > cfg.FormMaxFillTime:
+		return fmt.Errorf("%w: submitted %s after rendering, maximum is %s", errFormTokenExpired, elapsed.Round(time.Second), cfg.FormMaxFillTime)
+	case spentFormTokens != nil && isSpentFormToken(nonce):
+		return errFormTokenReused
+	case elapsed < cfg.FormMinFillTime:
+		return fmt.Errorf("submitted %s after rendering, minimum is %s", elapsed.Round(time.Millisecond), cfg.FormMinFillTime)
+	case spentFormTokens != nil && !spentFormTokens.add(nonce, struct{}{}):
+		// Spent by a concurrent submission since the check above
+		return errFormTokenReused
+	}
+	return nil
+}
+
+func isSpentFormToken(nonce string) bool {
+	_, ok := spentFormTokens.get(nonce)
+	return ok
+}
+
+// Give back a token spent by checkFormToken
+func releaseFormToken(token string) {
+	if parts := strings.Split(token, "."); spentFormTokens != nil && len(parts) == 3 {
+		spentFormTokens.delete(parts[1])
+	}
+}
+
+// Issue a form token (GET /api/contact/token), fetched by the frontend
+// when it renders the form. 404 when form tokens are off.
+func formTokenHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := currentConfig()
+	if cfg.FormTokenSecret == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	now := time.Now()
+	resp := map[string]any{"formToken": signFormToken(cfg.FormTokenSecret, now)}
+	if cfg.FormMaxFillTime > 0 {
+		resp["expiresAt"] = now.Add(cfg.FormMaxFillTime).UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
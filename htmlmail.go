@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const logoContentID = "logo@next-kiosk.com"
+
+// Load the brand logo embedded in HTML emails
+func loadLogo(path string) (*inlinePart, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ctype := http.DetectContentType(data)
+	if !strings.HasPrefix(ctype, "image/") {
+		return nil, fmt.Errorf("%s is %s, not an image", path, ctype)
+	}
+	return &inlinePart{
+		ContentID:   logoContentID,
+		ContentType: ctype,
+		Filename:    filepath.Base(path),
+		Data:        data,
+	}, nil
+}
+
+var htmlLayout = template.Must(template.New("layout").Parse(`<!DOCTYPE html>
+<html>
+<body style="margin:0;padding:24px;background:#f4f5f7;font-family:Arial,Helvetica,sans-serif;color:#222">
+<table role="presentation" width="100%" cellpadding="0" cellspacing="0" style="max-width:600px;margin:0 auto;background:#fff;border-radius:6px">
+{{if .LogoCID}}<tr><td style="padding:24px;border-bottom:1px solid #eee"><img src="cid:{{.LogoCID}}" alt="Next Kiosk" style="max-height:48px"></td></tr>{{end}}
+<tr><td style="padding:24px">{{.Content}}</td></tr>
+{{if .Footer}}<tr><td style="padding:16px 24px;border-top:1px solid #eee;font-size:12px;color:#777;white-space:pre-wrap">{{.Footer}}</td></tr>{{end}}
+</table>
+</body>
+</html>
+`))
+
+var notificationHTMLContent = template.Must(template.New("notification").Parse(`<h2 style="margin-top:0">New contact form submission</h2>
+<table role="presentation" cellpadding="4" cellspacing="0">
+<tr><td><b>Reference</b></td><td>{{.Ref}}</td></tr>
+<tr><td><b>Received</b></td><td>{{.Received}}</td></tr>
+<tr><td><b>Form</b></td><td>{{.FormType}}</td></tr>
+{{if .LeadPriority}}<tr><td><b>Lead priority</b></td><td>{{.LeadPriority}}</td></tr>
+{{end}}<tr><td><b>Name</b></td><td>{{.FirstName}} {{.LastName}}</td></tr>
+<tr><td><b>Email</b></td><td><a href="mailto:{{.Email}}">{{.Email}}</a></td></tr>
+<tr><td><b>Phone</b></td><td>{{.Phone}}</td></tr>
+<tr><td><b>Company</b></td><td>{{.Company}}</td></tr>
+<tr><td><b>Budget</b></td><td>{{.Budget}}</td></tr>
+<tr><td><b>Preferred callback</b></td><td>{{.Callback}}</td></tr>
+{{if or .UTMSource .UTMMedium .UTMCampaign}}<tr><td><b>Campaign</b></td><td>{{.UTMSource}} / {{.UTMMedium}} / {{.UTMCampaign}}</td></tr>
+{{end}}{{if .Attachments}}<tr><td><b>Attachments</b></td><td>{{.Attachments}}</td></tr>
+{{end}}</table>
+<p style="white-space:pre-wrap;border-left:3px solid #ddd;padding-left:12px">{{.Message}}</p>
+`))
+
+var autoReplyHTMLContent = template.Must(template.New("autoreply").Parse(`<p>{{.Greeting}}</p>
+<p>{{.Received}}</p>
+<p><b>{{.RefNote}}</b></p>
+<p>{{.SignOff}}</p>
+`))
+
+// Plain-text auto-reply templates, shown as-is inside the branded layout
+var textAutoReplyHTMLContent = template.Must(template.New("autoreply-text").Parse(`<p style="white-space:pre-wrap">{{.Text}}</p>
+`))
+
+func renderBrandedHTML(content *template.Template, data any) (string, error) {
+	var inner strings.Builder
+	if err := content.Execute(&inner, data); err != nil {
+		return "", err
+	}
+	logoCID := ""
+	if currentConfig().Logo != nil {
+		logoCID = logoContentID
+	}
+	var out strings.Builder
+	err := currentTemplates().layout.Execute(&out, map[string]any{
+		"LogoCID": logoCID,
+		"Content": template.HTML(inner.String()),
+		"Footer":  currentConfig().EmailFooter,
+	})
+	return out.String(), err
+}
+
+// Attach the branded HTML alternative and logo when EMAIL_LOGO_PATH is
+// configured; otherwise the email stays plain text
+func addBrandedHTML(e *Email, content *template.Template, data any) {
+	if currentConfig().Logo == nil {
+		return
+	}
+	setBrandedHTML(e, content, data)
+}
+
+// Attach the HTML alternative whether or not there is a logo, which is
+// embedded when configured. On a render error the email stays plain text.
+func setBrandedHTML(e *Email, content *template.Template, data any) {
+	html, err := renderBrandedHTML(content, data)
+	if err != nil {
+		log.Printf("HTML email render error: %v", err)
+		return
+	}
+	e.HTML = html
+	if logo := currentConfig().Logo; logo != nil {
+		e.Inline = append(e.Inline, *logo)
+	}
+}
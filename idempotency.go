@@ -0,0 +1,31 @@
+package main
+
+// Requests sent with an Idempotency-Key header are remembered for
+// IDEMPOTENCY_WINDOW so a client retrying after a dropped response gets the
+// original reference ID instead of triggering a second email. A key maps to
+// "" while its request is in flight and to the reference ID once it
+// succeeded; failed requests release the key so the retry is processed.
+var idempotencyKeys *ttlCache[string]
+
+// Keys are opaque client-chosen strings, typically UUIDs
+const maxIdempotencyKeyLength = 255
+
+// Claim key for this request. When it is already taken, ref is the
+// reference ID of the earlier successful request, or "" if that request
+// has not finished yet.
+func claimIdempotencyKey(key string) (ref string, claimed bool) {
+	if idempotencyKeys.add(key, "") {
+		return "", true
+	}
+	ref, _ = idempotencyKeys.get(key)
+	return ref, false
+}
+
+// Settle a claimed key: remember ref on success, free it otherwise
+func finishIdempotencyKey(key, ref string) {
+	if ref == "" {
+		idempotencyKeys.delete(key)
+		return
+	}
+	idempotencyKeys.set(key, ref)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweeper is implemented by in-memory stores that hold expiring entries
+type sweeper interface {
+	sweep(now time.Time)
+}
+
+var (
+	sweepersMu sync.Mutex
+	sweepers   []sweeper
+)
+
+// Register a store to be pruned by the shared janitor goroutine
+func registerSweeper(s sweeper) {
+	sweepersMu.Lock()
+	sweepers = append(sweepers, s)
+	sweepersMu.Unlock()
+}
+
+func sweepAll(now time.Time) {
+	sweepersMu.Lock()
+	defer sweepersMu.Unlock()
+	for _, s := range sweepers {
+		s.sweep(now)
+	}
+}
+
+// Sweep every registered store on each tick until ctx is cancelled
+func runJanitor(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sweepAll(now)
+		}
+	}
+}
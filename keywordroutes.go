@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// KEYWORD_ROUTE_MATCH: use the first matching rule or every one
+const (
+	keywordMatchFirst = "first"
+	keywordMatchAll   = "all"
+)
+
+// KEYWORD_ROUTE_ACTION: matched recipients replace the route's or are
+// added as Cc
+const (
+	keywordActionReplace = "replace"
+	keywordActionCc      = "cc"
+)
+
+// One KEYWORD_ROUTES rule: messages mentioning any of Keywords as a
+// whole word, ignoring case, also concern Recipient, which may list
+// several comma-separated addresses
+type keywordRoute struct {
+	Keywords  []string `json:"keywords"`
+	Recipient string   `json:"recipient"`
+
+	recipients []string
+	pattern    *regexp.Regexp
+}
+
+// Parse KEYWORD_ROUTES, a JSON array evaluated in order, e.g.
+// [{"keywords": ["billing", "invoice"], "recipient": "finance@next-kiosk.com"},
+// {"keywords": ["bug"], "recipient": "engineering@next-kiosk.com"}]
+func parseKeywordRoutes(raw string) ([]*keywordRoute, error) {
+	var routes []*keywordRoute
+	if raw == "" {
+		return nil, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &routes); err != nil {
+		return nil, err
+	}
+	for i, kr := range routes {
+		if kr == nil || len(kr.Keywords) == 0 {
+			return nil, fmt.Errorf("rule %d has no keywords", i+1)
+		}
+		kr.recipients = splitList(kr.Recipient)
+		if len(kr.recipients) == 0 {
+			return nil, fmt.Errorf("rule %d has no recipient", i+1)
+		}
+		for _, addr := range kr.recipients {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return nil, fmt.Errorf("rule %d: recipient %q: %w", i+1, addr, err)
+			}
+		}
+		quoted := make([]string, 0, len(kr.Keywords))
+		for _, kw := range kr.Keywords {
+			if kw = strings.TrimSpace(kw); kw == "" {
+				return nil, errors.New("keywords must not be empty")
+			}
+			quoted = append(quoted, regexp.QuoteMeta(kw))
+		}
+		// \b only knows ASCII, which would miss keywords like "ödeme"
+		kr.pattern = regexp.MustCompile(`(?i)(?:^|[^\pL\pN])(?:` + strings.Join(quoted, "|") + `)(?:$|[^\pL\pN])`)
+	}
+	return routes, nil
+}
+
+// Recipients of the KEYWORD_ROUTES rules matching message, without
+// duplicates; nil when none match
+func keywordRecipients(cfg *Config, message string) []string {
+	var to []string
+	for _, kr := range cfg.KeywordRoutes {
+		if !kr.pattern.MatchString(message) {
+			continue
+		}
+		for _, addr := range kr.recipients {
+			if !slices.Contains(to, addr) {
+				to = append(to, addr)
+			}
+		}
+		if cfg.KeywordMatch == keywordMatchFirst {
+			break
+		}
+	}
+	return to
+}
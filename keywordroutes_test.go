@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeywordRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		rules   int
+		wantErr bool
+	}{
+		{name: "unset", raw: ""},
+		{name: "two rules", raw: `[{"keywords": ["billing", "invoice"], "recipient": "finance@next-kiosk.com"}, {"keywords": ["bug"], "recipient": "dev@next-kiosk.com, qa@next-kiosk.com"}]`, rules: 2},
+		{name: "no keywords", raw: `[{"keywords": [], "recipient": "finance@next-kiosk.com"}]`, wantErr: true},
+		{name: "blank keyword", raw: `[{"keywords": ["billing", " "], "recipient": "finance@next-kiosk.com"}]`, wantErr: true},
+		{name: "no recipient", raw: `[{"keywords": ["billing"]}]`, wantErr: true},
+		{name: "invalid recipient", raw: `[{"keywords": ["billing"], "recipient": "finance"}]`, wantErr: true},
+		{name: "null rule", raw: `[null]`, wantErr: true},
+		{name: "not JSON", raw: `billing=finance@next-kiosk.com`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes, err := parseKeywordRoutes(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(routes) != tt.rules {
+				t.Errorf("got %d rules, want %d", len(routes), tt.rules)
+			}
+		})
+	}
+}
+
+func TestKeywordRecipients(t *testing.T) {
+	routes, err := parseKeywordRoutes(`[{"keywords": ["billing", "ödeme"], "recipient": "finance@next-kiosk.com"}, {"keywords": ["bug"], "recipient": "dev@next-kiosk.com, finance@next-kiosk.com"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		match   string
+		message string
+		want    []string
+	}{
+		{"no match", keywordMatchFirst, "We would like a quote.", nil},
+		{"whole words only", keywordMatchFirst, "Our debugging kiosk needs rebilling.", nil},
+		{"ignores case", keywordMatchFirst, "A BILLING question.", []string{"finance@next-kiosk.com"}},
+		{"non-ASCII keyword", keywordMatchFirst, "Ödeme yapamıyorum.", []string{"finance@next-kiosk.com"}},
+		{"first rule wins", keywordMatchFirst, "A bug in billing.", []string{"finance@next-kiosk.com"}},
+		{"all rules, without duplicates", keywordMatchAll, "A bug in billing.", []string{"finance@next-kiosk.com", "dev@next-kiosk.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{KeywordRoutes: routes, KeywordMatch: tt.match}
+			if got := keywordRecipients(cfg, tt.message); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keywordRecipients(%q) = %v, want %v", tt.message, got, tt.want)
+			}
+		})
+	}
+}
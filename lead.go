@@ -0,0 +1,43 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// Lead priorities, shown in the notification and the submission log
+const (
+	leadPriorityHigh   = "high"
+	leadPriorityNormal = "normal"
+)
+
+// Consumer mailbox providers; a lead writing from any other domain is
+// assumed to use a company address
+const defaultFreeEmailDomains = "gmail.com,googlemail.com,yahoo.com,yahoo.de,hotmail.com,hotmail.de," +
+	"outlook.com,outlook.de,live.com,msn.com,icloud.com,me.com,aol.com,gmx.de,gmx.net,gmx.at," +
+	"web.de,t-online.de,freenet.de,posteo.de,mail.de,mail.com,proton.me,protonmail.com,yandex.com"
+
+// Score form against the LEAD_* rules, one point for each of a business
+// email domain, a budget of at least LEAD_BUDGET_MIN and a message of at
+// least LEAD_MESSAGE_MIN characters. LEAD_PRIORITY_THRESHOLD points make
+// the lead high priority; with the threshold at 0 leads aren't scored.
+func leadPriority(cfg *Config, form ContactForm) (score int, priority string) {
+	if cfg.LeadPriorityThreshold <= 0 {
+		return 0, ""
+	}
+	if _, domain, ok := strings.Cut(form.Email, "@"); ok && !cfg.FreeEmailDomains[strings.ToLower(domain)] {
+		score++
+	}
+	if cfg.LeadBudgetMin != "" && form.Budget != "" {
+		if i := slices.Index(cfg.BudgetOptions, form.Budget); i >= 0 && i >= slices.Index(cfg.BudgetOptions, cfg.LeadBudgetMin) {
+			score++
+		}
+	}
+	if cfg.LeadMessageMin > 0 && len([]rune(form.Message)) >= cfg.LeadMessageMin {
+		score++
+	}
+	if score >= cfg.LeadPriorityThreshold {
+		return score, leadPriorityHigh
+	}
+	return score, leadPriorityNormal
+}
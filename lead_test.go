@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestLeadPriority(t *testing.T) {
+	cfg := &Config{
+		LeadPriorityThreshold: 2,
+		LeadBudgetMin:         "10k-50k",
+		LeadMessageMin:        20,
+		BudgetOptions:         []string{"<10k", "10k-50k", ">50k"},
+		FreeEmailDomains:      map[string]bool{"gmail.com": true},
+	}
+	long := "We need 40 kiosks for our stores."
+	tests := []struct {
+		name      string
+		cfg       *Config
+		form      ContactForm
+		wantScore int
+		want      string
+	}{
+		{"scoring off", &Config{}, ContactForm{Email: "jane@acme.com"}, 0, ""},
+		{"nothing matches", cfg, ContactForm{Email: "jane@gmail.com", Budget: "<10k", Message: "Hi"}, 0, leadPriorityNormal},
+		{"free mail ignores case", cfg, ContactForm{Email: "jane@GMail.com", Message: long}, 1, leadPriorityNormal},
+		{"business email only", cfg, ContactForm{Email: "jane@acme.com", Message: "Hi"}, 1, leadPriorityNormal},
+		{"budget at the minimum", cfg, ContactForm{Email: "jane@acme.com", Budget: "10k-50k"}, 2, leadPriorityHigh},
+		{"budget above the minimum", cfg, ContactForm{Email: "jane@gmail.com", Budget: ">50k", Message: long}, 2, leadPriorityHigh},
+		{"unknown budget", cfg, ContactForm{Email: "jane@gmail.com", Budget: "lots", Message: long}, 1, leadPriorityNormal},
+		{"everything", cfg, ContactForm{Email: "jane@acme.com", Budget: ">50k", Message: long}, 3, leadPriorityHigh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, priority := leadPriority(tt.cfg, tt.form)
+			if score != tt.wantScore || priority != tt.want {
+				t.Errorf("leadPriority = %d, %q, want %d, %q", score, priority, tt.wantScore, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pick the locale for a submission: the form's Locale field first, then
+// the Accept-Language preferences. Each candidate falls back from region
+// to base language (tr-TR -> tr); if nothing is supported the default
+// locale is used.
+func resolveLocale(cfg *Config, formLocale string, r *http.Request) string {
+	candidates := []string{}
+	if formLocale != "" {
+		candidates = append(candidates, formLocale)
+	}
+	candidates = append(candidates, parseAcceptLanguage(r.Header.Get("Accept-Language"))...)
+
+	for _, c := range candidates {
+		for _, tag := range localeChain(c) {
+			if slices.Contains(cfg.SupportedLocales, tag) {
+				return tag
+			}
+		}
+	}
+	return cfg.DefaultLocale
+}
+
+// tr-tr -> [tr-TR, tr]
+func localeChain(tag string) []string {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if tag == "" || tag == "*" {
+		return nil
+	}
+	base, region, ok := strings.Cut(tag, "-")
+	base = strings.ToLower(base)
+	if !ok {
+		return []string{base}
+	}
+	return []string{base + "-" + strings.ToUpper(region), base}
+}
+
+// Language tags from an Accept-Language header, most preferred first
+func parseAcceptLanguage(header string) []string {
+	type pref struct {
+		tag string
+		q   float64
+	}
+	var prefs []pref
+	for _, item := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, pref{tag, q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+
+	tags := make([]string, len(prefs))
+	for i, p := range prefs {
+		tags[i] = p.tag
+	}
+	return tags
+}
+
+// Wording of the customer auto-reply in one language
+type autoReplyCopy struct {
+	Subject  string // formatted with the reference ID
+	Greeting string // formatted with the first name
+	Received string
+	RefNote  string // formatted with the reference ID
+	SignOff  string
+}
+
+var autoReplyCopies = map[string]autoReplyCopy{
+	"en": {
+		Subject:  "We received your message [%s]",
+		Greeting: "Hello %s,",
+		Received: "Thank you for contacting Next Kiosk. We have received your message and will get back to you as soon as possible.",
+		RefNote:  "Your reference number is %s. Please keep it in the subject line if you reply to this email.",
+		SignOff:  "Next Kiosk",
+	},
+	"tr": {
+		Subject:  "Mesajınızı aldık [%s]",
+		Greeting: "Merhaba %s,",
+		Received: "Next Kiosk ile iletişime geçtiğiniz için teşekkür ederiz. Mesajınızı aldık, en kısa sürede size dönüş yapacağız.",
+		RefNote:  "Referans numaranız %s. Bu e-postayı yanıtlarken lütfen konu satırında tutunuz.",
+		SignOff:  "Next Kiosk",
+	},
+}
+
+// Auto-reply wording for a locale, falling back through its base
+// language to English
+func autoReplyCopyFor(locale string) autoReplyCopy {
+	for _, tag := range append(localeChain(locale), "en") {
+		if c, ok := autoReplyCopies[tag]; ok {
+			return c
+		}
+	}
+	return autoReplyCopies["en"]
+}
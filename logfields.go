@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// How redacted log values are written
+const (
+	redactHash = "hash"
+	redactMask = "mask"
+)
+
+// Log a submission event as key=value pairs. Fields listed in
+// LOG_REDACT_FIELDS are replaced by a short HMAC, which still lets the
+// same submitter be correlated across lines, or by "[redacted]" with
+// LOG_REDACT_MODE=mask. The message itself is never logged, only its
+// length.
+func logSubmission(event string, sub *Submission) {
+	cfg := currentConfig()
+	form := sub.Form
+
+	var b strings.Builder
+	b.WriteString("Submission " + sub.ID + " " + event + ":")
+	field := func(name, v string) {
+		if v == "" {
+			return
+		}
+		if cfg.LogRedactFields[name] {
+			v = redactValue(cfg, v)
+		}
+		b.WriteString(" " + name + "=" + logValue(v))
+	}
+
+	field("formType", form.FormType)
+	field("locale", form.Locale)
+	if sub.LeadPriority != "" {
+		field("leadPriority", sub.LeadPriority)
+		field("leadScore", strconv.Itoa(sub.LeadScore))
+	}
+	for _, rule := range formRules {
+		if rule.field != "message" {
+			field(rule.field, rule.value(&form))
+		}
+	}
+	b.WriteString(" messageLength=" + strconv.Itoa(len([]rune(form.Message))))
+	log.Print(b.String())
+}
+
+// MODE=log keeps no record, so the whole submission goes to the log for
+// manual review, with LOG_REDACT_FIELDS redacted as in logSubmission
+func logFullSubmission(sub *Submission) {
+	cfg := currentConfig()
+	redacted := *sub
+	fields := conditionFields(&redacted.Form)
+	for name := range cfg.LogRedactFields {
+		if p, ok := fields[name]; ok && *p != "" {
+			*p = redactValue(cfg, *p)
+		}
+	}
+	log.Printf("Submission %s (MODE=log, not stored or emailed):\n%s", sub.ID, notificationBody(&redacted))
+}
+
+// Key for hashed log values without LOG_REDACT_KEY. Hashes then only
+// correlate within one run, but can't be reversed by hashing guesses.
+var processRedactKey = func() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}()
+
+func redactValue(cfg *Config, v string) string {
+	if cfg.LogRedactMode == redactMask {
+		return "[redacted]"
+	}
+	key := processRedactKey
+	if cfg.LogRedactKey != "" {
+		key = []byte(cfg.LogRedactKey)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.ToLower(v)))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:6])
+}
+
+// Quote values that would otherwise break the key=value format
+func logValue(v string) string {
+	if q := strconv.Quote(v); q[1:len(q)-1] != v || strings.ContainsAny(v, " =") {
+		return q
+	}
+	return v
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// Email is an outgoing message before it is serialized
+type Email struct {
+	// Header From; defaults to the authenticated SMTP account
+	From string
+	To   []string
+	// Copied recipients, shown in the Cc header
+	Cc      []string
+	Subject string
+	// Plain-text body, also the fallback when HTML is set
+	Body string
+	// Optional HTML alternative and the images it references by cid:
+	HTML   string
+	Inline []inlinePart
+	// Extra headers, e.g. X-Contact-Flags
+	Headers map[string]string
+	// Files attached after the content
+	Attachments []*attachment
+	// Encrypt the content to these keys when set
+	EncryptTo openpgp.EntityList
+}
+
+// Serialize the message with the standard headers. When From is an alias
+// the authenticated account is named in Sender, which keeps SPF/DMARC
+// alignment with the envelope sender.
+func (e *Email) bytes() ([]byte, error) {
+	account := currentConfig().SMTPEmail
+	from := e.From
+	if from == "" {
+		from = account
+	}
+
+	var b strings.Builder
+	b.WriteString("From: Next Kiosk <" + from + ">\r\n")
+	if !strings.EqualFold(from, account) {
+		b.WriteString("Sender: <" + account + ">\r\n")
+	}
+	ctype, cte, body, err := e.content()
+	if err != nil {
+		return nil, err
+	}
+	if e.EncryptTo != nil {
+		if ctype, body, err = pgpEncrypt(e.EncryptTo, ctype, cte, body); err != nil {
+			return nil, fmt.Errorf("pgp: %w", err)
+		}
+		cte = ""
+	}
+	b.WriteString("To: " + strings.Join(e.To, ", ") + "\r\n")
+	if len(e.Cc) > 0 {
+		b.WriteString("Cc: " + strings.Join(e.Cc, ", ") + "\r\n")
+	}
+	b.WriteString("Subject: " + encodeHeader(sanitizeHeader(e.Subject)) + "\r\n" +
+		"Date: " + formatDateRFC5322() + "\r\n")
+	for _, k := range slices.Sorted(maps.Keys(e.Headers)) {
+		b.WriteString(k + ": " + encodeHeader(sanitizeHeader(e.Headers[k])) + "\r\n")
+	}
+	b.WriteString(
+		"MIME-Version: 1.0\r\n" +
+			"Content-Type: " + ctype + "\r\n")
+	if cte != "" {
+		b.WriteString("Content-Transfer-Encoding: " + cte + "\r\n")
+	}
+	b.WriteString("\r\n")
+	b.Write(body)
+	return []byte(b.String()), nil
+}
+
+// Append the configured signature using the conventional "-- " separator
+func withFooter(body string) string {
+	footer := currentConfig().EmailFooter
+	if footer == "" {
+		return body
+	}
+	return strings.TrimRight(body, " \t\r\n") + "\n\n-- \n" + footer + "\n"
+}
+
+// Mailer delivers an already composed message
+type Mailer interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+var mailer Mailer = smtpMailer{}
+
+// The mailer to use right now; MAIL_DRY_RUN can be toggled by /reload
+func activeMailer() Mailer {
+	if currentConfig().MailDryRun {
+		return dryRunMailer{}
+	}
+	return mailer
+}
+
+// Logs messages instead of sending them, for local development
+type dryRunMailer struct{}
+
+func (dryRunMailer) Send(from string, to []string, msg []byte) error {
+	log.Printf("[dry-run] mail from %s to %v:\n%s", from, to, msg)
+	return nil
+}
+
+var errNoRecipients = errors.New("email has no recipients")
+
+// Send through the configured mailer, enveloped as SMTP_ENVELOPE_FROM
+// (the authenticated account by default) whatever the header From is.
+// OVERRIDE_RECIPIENT redirects every message,
+// auto-replies included, so staging never mails real addresses.
+func sendMail(e *Email) error {
+	cfg := currentConfig()
+	if cfg.OverrideRecipient != "" {
+		log.Printf("Redirecting mail for %v to %s (OVERRIDE_RECIPIENT)", e.To, cfg.OverrideRecipient)
+		redirected := *e
+		redirected.To = []string{cfg.OverrideRecipient}
+		redirected.Cc = nil
+		e = &redirected
+	}
+	if len(e.To) == 0 {
+		return errNoRecipients
+	}
+	msg, err := e.bytes()
+	if err != nil {
+		return err
+	}
+	return activeMailer().Send(cfg.SMTPEnvelopeFrom, append(slices.Clone(e.To), e.Cc...), msg)
+}
+
+// Fallback subject when a configured template fails to render
+func notificationSubject(ref string) string {
+	return fmt.Sprintf("New Contact Form Submission [%s]", ref)
+}
+
+func notificationBody(sub *Submission) string {
+	return withFooter(wrapText(notificationText(sub), currentConfig().MailWrapColumn))
+}
+
+// Hard-wrap lines longer than width characters at spaces, repeating the
+// line's indentation on the continuation lines. Words are never split,
+// so a URL longer than width keeps a line of its own and stays clickable.
+func wrapText(text string, width int) string {
+	if width <= 0 {
+		return text
+	}
+	var b strings.Builder
+	for line := range strings.Lines(text) {
+		content := strings.TrimRight(line, "\r\n")
+		if utf8.RuneCountInString(content) <= width {
+			b.WriteString(line)
+			continue
+		}
+		indent := content[:len(content)-len(strings.TrimLeft(content, " \t"))]
+		b.WriteString(indent)
+		col, lineStart := utf8.RuneCountInString(indent), true
+		for _, word := range strings.Fields(content) {
+			n := utf8.RuneCountInString(word)
+			if !lineStart && col+1+n > width {
+				b.WriteString("\n" + indent)
+				col, lineStart = utf8.RuneCountInString(indent), true
+			}
+			if !lineStart {
+				b.WriteByte(' ')
+				col++
+			}
+			b.WriteString(word)
+			col += n
+			lineStart = false
+		}
+		b.WriteString(line[len(content):])
+	}
+	return b.String()
+}
+
+// Plain-text notification, rendered from the same notificationView as
+// the HTML one so the two can't drift apart
+var notificationTextContent = texttemplate.Must(texttemplate.New("notification-text").Parse(`
+	Reference: {{.Ref}}
+	Received: {{.Received}}
+	Form: {{.FormType}}
+	Lead priority: {{.LeadPriority}}
+
+	New message from: {{.FirstName}} {{.LastName}}
+	Email: {{.Email}}
+	Phone: {{.Phone}}
+	Company: {{.Company}}
+	Budget: {{.Budget}}
+	Preferred callback: {{.Callback}}
+
+	UTM source: {{.UTMSource}}
+	UTM medium: {{.UTMMedium}}
+	UTM campaign: {{.UTMCampaign}}
+
+	Attachments: {{.Attachments}}
+	Flags: {{.Flags}}
+
+	Message:
+	{{.Message}}
+	`))
+
+// Notification body for one submission, without the signature. The
+// templates are trial-rendered when loaded, so the built-in one is only
+// a fallback for a failure that check didn't catch.
+func notificationText(sub *Submission) string {
+	v := newNotificationView(sub)
+	var b strings.Builder
+	if err := currentTemplates().notificationText.Execute(&b, v); err != nil {
+		log.Printf("Text notification render error for %s: %v", sub.ID, err)
+		b.Reset()
+		notificationTextContent.Execute(&b, v)
+	}
+	return b.String()
+}
+
+// Notification for the team, addressed by the route for the form type
+// and any KEYWORD_ROUTES the message matches
+func newNotification(sub *Submission) *Email {
+	cfg := currentConfig()
+	route := cfg.route(sub.Form.FormType, sub.Origin)
+	subject, err := route.renderSubject(mailData{ContactForm: sub.Form, Ref: sub.ID})
+	if err != nil {
+		log.Printf("Subject template error for %s: %v", sub.ID, err)
+		subject = notificationSubject(sub.ID)
+	}
+	if len(sub.Flags) > 0 {
+		subject = "[Flagged: " + strings.Join(sub.Flags, ", ") + "] " + subject
+	}
+	if sub.LeadPriority == leadPriorityHigh {
+		subject = "[Priority: high] " + subject
+	}
+	e := &Email{
+		From:    route.From,
+		To:      route.recipients,
+		Subject: subject,
+		Body:    notificationBody(sub),
+	}
+	if matched := keywordRecipients(cfg, sub.Form.Message); len(matched) > 0 {
+		debugf("Submission %s matched keyword routes for %v", sub.ID, matched)
+		if cfg.KeywordAction == keywordActionCc {
+			e.Cc = slices.DeleteFunc(matched, func(addr string) bool { return slices.Contains(e.To, addr) })
+		} else {
+			e.To = matched
+		}
+	}
+	e.Headers = map[string]string{}
+	if len(sub.Flags) > 0 {
+		e.Headers["X-Contact-Flags"] = strings.Join(sub.Flags, ", ")
+	}
+	// Lets the inbox sort leads with a filter rule
+	if sub.LeadPriority != "" {
+		e.Headers["X-Lead-Priority"] = sub.LeadPriority
+	}
+	setBrandedHTML(e, currentTemplates().notification, newNotificationView(sub))
+	e.EncryptTo = currentConfig().PGPKeys
+	return e
+}
+
+// Values shown in the HTML notification
+type notificationView struct {
+	mailData
+	Received string
+	FormType string
+	// Preferred callback time in the display timezone, if requested
+	Callback string
+	// Uploaded files, comma separated
+	Attachments string
+	// Markers such as "profanity", comma separated
+	Flags string
+	// Lead priority and score, e.g. "high (score 2)"; empty when leads
+	// aren't scored
+	LeadPriority string
+}
+
+func newNotificationView(sub *Submission) notificationView {
+	formType := sub.Form.FormType
+	if formType == "" {
+		formType = "contact"
+	}
+	v := notificationView{
+		mailData: mailData{ContactForm: sub.Form, Ref: sub.ID},
+		Received: localTime(sub.CreatedAt).Format("2006-01-02 15:04:05 MST"),
+		FormType: formType,
+
+		Attachments: strings.Join(sub.Attachments, ", "),
+		Flags:       strings.Join(sub.Flags, ", "),
+	}
+	if sub.LeadPriority != "" {
+		v.LeadPriority = fmt.Sprintf("%s (score %d)", sub.LeadPriority, sub.LeadScore)
+	}
+	if t, err := time.Parse(time.RFC3339, sub.Form.PreferredTime); err == nil {
+		v.Callback = localTime(t).Format("Mon 2006-01-02 15:04 MST")
+	}
+	return v
+}
+
+// Confirmation sent back to the submitter, from the form route's
+// autoReply template when it has one and otherwise the generic copy in
+// their resolved locale. The reference in the subject survives the
+// customer's "Re:" so replies can be matched to the record.
+func sendAutoReply(sub *Submission) {
+	form, ref := sub.Form, sub.ID
+	if route := currentConfig().route(form.FormType, sub.Origin); route.autoReply != nil {
+		subject, body, err := route.renderAutoReply(mailData{ContactForm: form, Ref: ref})
+		if err == nil {
+			reply := &Email{To: []string{form.Email}, Subject: subject, Body: withFooter(body)}
+			addBrandedHTML(reply, currentTemplates().autoReplyText, map[string]string{"Text": strings.TrimSpace(body)})
+			if err := sendMail(reply); err != nil {
+				log.Printf("Auto-reply %s send error: %v", ref, err)
+			}
+			return
+		}
+		log.Printf("Auto-reply %s template error, using the generic reply: %v", ref, err)
+	}
+
+	c := autoReplyCopyFor(form.Locale)
+	greeting := fmt.Sprintf(c.Greeting, form.FirstName)
+	refNote := fmt.Sprintf(c.RefNote, ref)
+	body := greeting + "\n\n" + c.Received + "\n\n" + refNote + "\n\n" + c.SignOff + "\n"
+
+	reply := &Email{To: []string{form.Email}, Subject: fmt.Sprintf(c.Subject, ref), Body: withFooter(body)}
+	addBrandedHTML(reply, currentTemplates().autoReply, map[string]string{
+		"Greeting": greeting,
+		"Received": c.Received,
+		"RefNote":  refNote,
+		"SignOff":  c.SignOff,
+	})
+	if err := sendMail(reply); err != nil {
+		log.Printf("Auto-reply %s send error: %v", ref, err)
+	}
+}
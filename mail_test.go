@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		width int
+		want  string
+	}{
+		{"off", "a long line that is not wrapped", 0, "a long line that is not wrapped"},
+		{"short lines untouched", "Name: Jane\r\nPhone: 123\n", 20, "Name: Jane\r\nPhone: 123\n"},
+		{"wrapped at spaces", "one two three four five", 10, "one two\nthree four\nfive"},
+		{"indentation repeated", "\tMessage: one two three\n", 14, "\tMessage: one\n\ttwo three\n"},
+		{"long words kept whole", "see https://next-kiosk.com/a/very/long/path now", 12, "see\nhttps://next-kiosk.com/a/very/long/path\nnow"},
+		{"counts runes", "Şirin Öztürk Yılmaz", 12, "Şirin Öztürk\nYılmaz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wrapText(tt.text, tt.width); got != tt.want {
+				t.Errorf("wrapText(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"net/smtp"
+	"net/mail"
 	"os"
+	"os/signal"
+	"reflect"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -19,145 +28,738 @@ type ContactForm struct {
 	Email     string `json:"email"`
 	Phone     string `json:"phone"`
 	Company   string `json:"company"`
-	Message   string `json:"message"`
-	Token     string `json:"recaptchaToken"`
-}
-
-// Recaptcha verification response
-type RecaptchaResponse struct {
-	Success bool    `json:"success"`
-	Score   float64 `json:"score"`
+	Budget    string `json:"budget"`
+	// Requested callback slot, RFC 3339
+	PreferredTime string `json:"preferredTime"`
+	Message       string `json:"message"`
+	Token         string `json:"recaptchaToken,omitempty"`
+	// Signed render time from /api/contact/token
+	FormToken string `json:"formToken,omitempty"`
+	FormType  string `json:"formType"`
+	Locale    string `json:"locale"`
+	// Campaign attribution copied from the landing page URL
+	UTMSource   string `json:"utmSource"`
+	UTMMedium   string `json:"utmMedium"`
+	UTMCampaign string `json:"utmCampaign"`
 }
 
 // Email sending handler
 func contactHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := currentConfig()
+
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		w.Header().Set("Allow", "POST, OPTIONS")
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	var form ContactForm
-	err := json.NewDecoder(r.Body).Decode(&form)
-	if err != nil {
-		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+	// Monitors exercise the whole path with ?validate=true and stop short
+	// of storing or sending anything
+	dryRun := r.URL.Query().Get("validate") == "true"
+	if dryRun && !hasAPIKey(r, cfg.MonitorAPIKeys) {
+		writeError(w, r, http.StatusUnauthorized, "validate=true requires a valid X-API-Key")
 		return
 	}
 
+	ip := clientIP(r)
+
+	// === IDEMPOTENCY ===
+	var sentRef string
+	if key := r.Header.Get("Idempotency-Key"); key != "" && idempotencyKeys != nil {
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, r, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+		ref, claimed := claimIdempotencyKey(key)
+		if !claimed {
+			if ref == "" {
+				writeError(w, r, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+				return
+			}
+			// Anyone holding the key gets the replay, so it carries the
+			// reference only and never the stored form
+			debugf("Replaying response for Idempotency-Key %q (%s)", key, ref)
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeSuccess(w, r, ref, nil)
+			return
+		}
+		defer func() { finishIdempotencyKey(key, sentRef) }()
+	}
+
+	// Tokens claimed below only stay spent once the submission is
+	// accepted, so a visitor can fix a rejected form and send it again
+	var claimed []func()
+	defer func() {
+		if sentRef == "" {
+			for _, release := range claimed {
+				release()
+			}
+		}
+	}()
+
+	var (
+		form ContactForm
+		atts []*attachment
+	)
+	if isMultipart(r) {
+		var status int
+		var msg string
+		atts, status, msg = decodeMultipartBody(w, r, &form, cfg)
+		defer cleanupAttachments(atts)
+		if status != 0 {
+			writeError(w, r, status, msg)
+			return
+		}
+	} else if status, msg := decodeJSONBody(w, r, &form, cfg.MaxBodyBytes); status != 0 {
+		writeError(w, r, status, msg)
+		return
+	}
+	normalizeForm(&form)
+
+	// === IP BLOCKLIST ===
+	if reason := blockedReason(r.Context(), cfg, ip); reason != "" {
+		if cfg.BlocklistAction == blockSilent {
+			log.Printf("Blocked address %s (%s), discarding submission", ip, reason)
+			writeDecoySuccess(w, r, cfg, form, "blocklist")
+			return
+		}
+		log.Printf("Rejected submission from blocked address %s (%s)", ip, reason)
+		writeError(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	// === FORM TOKEN ===
+	// Like a honeypot: bots get the usual success but nothing is sent,
+	// unless a valid token is required and this one isn't. A token is
+	// single-use either way.
+	if cfg.FormTokenSecret != "" && !isSynthetic(r.Context()) {
+		err := checkFormToken(cfg, form.FormToken, time.Now())
+		if err == nil {
+			claimed = append(claimed, func() { releaseFormToken(form.FormToken) })
+		}
+		if errors.Is(err, errFormTokenReused) || cfg.FormTokenRequired && (errors.Is(err, errFormTokenInvalid) || errors.Is(err, errFormTokenExpired)) {
+			log.Printf("Rejected submission from %s: %v", ip, err)
+			writeError(w, r, http.StatusForbidden, "Missing, expired or already used form token, please reload the form")
+			return
+		}
+		if err != nil {
+			log.Printf("Form timing check tripped for %s, discarding submission: %v", ip, err)
+			writeDecoySuccess(w, r, cfg, form, "form_token")
+			return
+		}
+	}
+
+	origin := r.Header.Get("Origin")
+	if !slices.Contains(cfg.AllowedOrigins, origin) {
+		origin = ""
+	}
+
 	// === RECAPTCHA VALIDATION ===
-	if !verifyRecaptcha(form.Token) {
-		http.Error(w, "reCAPTCHA failed", http.StatusUnauthorized)
+	score := 1.0
+	if isSynthetic(r.Context()) {
+		debugf("reCAPTCHA skipped for synthetic submission")
+	} else if prefixesContain(cfg.CaptchaBypass, ip) {
+		log.Printf("reCAPTCHA bypassed for %s (CAPTCHA_BYPASS_IPS)", ip)
+	} else if isReplayedToken(form.Token) {
+		log.Printf("Rejected replayed reCAPTCHA token from %s", ip)
+		writeError(w, r, http.StatusUnauthorized, "reCAPTCHA token already used")
 		return
+	} else {
+		claimed = append(claimed, func() { releaseToken(form.Token) })
+		var err error
+		if score, err = verifyRecaptcha(r.Context(), form.Token, cfg.route(form.FormType, origin).RecaptchaAction); err != nil {
+			if errors.Is(err, errCaptchaBusy) {
+				w.Header().Set("Retry-After", "1")
+				writeError(w, r, http.StatusServiceUnavailable, "Captcha verification is busy, please retry shortly")
+				return
+			}
+			if errors.Is(err, errCaptchaExpired) {
+				writeError(w, r, http.StatusUnauthorized, "reCAPTCHA expired, please retry")
+				return
+			}
+			writeError(w, r, http.StatusUnauthorized, "reCAPTCHA failed")
+			return
+		}
+	}
+	// The limit depends on the score, so headers are only known from here
+	if limiter != nil {
+		setRateLimitHeaders(w, limiter.peek("ip:"+ip.String(), submissionLimit(score)))
 	}
 
 	// === BASIC VALIDATIONS ===
-	if !isValidEmail(form.Email) {
-		http.Error(w, "Invalid email", http.StatusBadRequest)
+	if errs := validate(form); len(errs) > 0 {
+		debugf("Validation failed: %v", errs)
+		writeValidationError(w, r, errs)
 		return
 	}
-	if form.FirstName == "" || form.LastName == "" || form.Message == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+
+	if cfg.CheckMX && !hasMailServer(r.Context(), cfg, form.Email) {
+		debugf("No mail server for %s", emailDomain(form.Email))
+		writeValidationError(w, r, []FieldError{{Field: "email", Message: "email domain has no mail server"}})
 		return
 	}
 
-	// === EMAIL COMPOSITION ===
-	from := os.Getenv("SMTP_EMAIL")
-	password := os.Getenv("SMTP_PASSWORD")
-	to := "info@next-kiosk.com"
+	// === RATE LIMITING ===
+	// Only valid submissions count, and dry runs don't, so neither typos
+	// nor a frequent monitor can lock out an address
+	if limiter != nil && !dryRun {
+		limit := submissionLimit(score)
+		byIP := limiter.allow("ip:"+ip.String(), limit)
+		byEmail := limiter.allow("email:"+strings.ToLower(form.Email), limit)
+		setRateLimitHeaders(w, byIP)
+		if !byIP.allowed || !byEmail.allowed {
+			tightest := byIP
+			if byEmail.count > tightest.count {
+				tightest = byEmail
+			}
+			if stepUpAllowed(cfg, tightest, score) {
+				log.Printf("Rate limit passed for %s with step-up score %.1f", ip, score)
+			} else if stepUpAvailable(cfg, tightest) {
+				log.Printf("Rate limit hit for %s (score %.1f, limit %d), asking for a captcha step-up", ip, score, limit)
+				writeStepUp(w, r, cfg.CaptchaStepUpScore)
+				return
+			} else {
+				log.Printf("Rate limit hit for %s (score %.1f, limit %d)", ip, score, limit)
+				reset := byIP.reset
+				if !byEmail.allowed && (byIP.allowed || byEmail.reset.After(reset)) {
+					reset = byEmail.reset
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+				writeError(w, r, http.StatusTooManyRequests, "Too many submissions, please try again later")
+				return
+			}
+		}
+	}
+
+	// === PROFANITY FILTER ===
+	var flags []string
+	if isSynthetic(r.Context()) {
+		flags = append(flags, flagSynthetic)
+	}
+	if field := profaneField(cfg, &form); field != "" {
+		switch cfg.ProfanityAction {
+		case profanityDrop:
+			log.Printf("Discarding submission from %s: disallowed words in %s", ip, field)
+			writeDecoySuccess(w, r, cfg, form, "profanity")
+			return
+		case profanityFlag:
+			flags = append(flags, flagProfanity)
+		default:
+			writeError(w, r, http.StatusBadRequest, field+": contains language that is not allowed")
+			return
+		}
+	}
 
-	subject := "New Contact Form Submission"
-	body := fmt.Sprintf(`
-	New message from: %s %s
-	Email: %s
-	Phone: %s
-	Company: %s
+	applyFieldDefaults(&form, cfg.FieldDefaults)
+	form.Locale = resolveLocale(cfg, form.Locale, r)
 
-	Message:
-	%s
-	`, form.FirstName, form.LastName, form.Email, form.Phone, form.Company, form.Message)
+	// Config loading already refuses an empty recipient list; this only
+	// guards against a route slipping through with none
+	if cfg.Mode == modeEmail && len(cfg.route(form.FormType, origin).recipients) == 0 {
+		log.Printf("No recipients configured for form type %q, check CONTACT_RECIPIENT, FORM_TYPES and ORIGIN_ROUTES", form.FormType)
+		writeError(w, r, http.StatusInternalServerError, "Contact form is not configured")
+		return
+	}
 
-	msg := []byte("To: " + to + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		"Content-Type: text/plain; charset=UTF-8\r\n" +
-		"\r\n" + body)
+	if dryRun {
+		log.Printf("Dry run from %s passed validation, nothing sent", ip)
+		if prefersText(r) {
+			writeText(w, http.StatusOK, "Submission is valid and would have been sent.")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":    "validated",
+			"wouldSend": true,
+			"message":   "Submission is valid and would have been sent",
+		})
+		return
+	}
 
-	auth := smtp.PlainAuth("", from, password, "smtpout.secureserver.net")
+	sub := newSubmission(form)
+	sub.Flags = flags
+	auditSubmission(r.Context(), sub)
+	sub.Origin = origin
+	sub.Attachments = attachmentSummary(atts)
+	if cfg.Mode == modeLog {
+		logFullSubmission(sub)
+		sentRef = sub.ID
+		writeSuccess(w, r, sub.ID, &sub.Form)
+		return
+	}
+	recordSubmission(sub, statusReceived, nil)
+	logSubmission("received", sub)
+	debugf("Submission %s received from %s", sub.ID, r.RemoteAddr)
+	appendToSheet(sub)
+	notifyWebhooks(sub)
+	if cfg.Mode == modeStore {
+		sentRef = sub.ID
+		writeSuccess(w, r, sub.ID, &sub.Form)
+		return
+	}
 
-	err = smtp.SendMail("smtpout.secureserver.net:587", auth, from, []string{to}, msg)
+	// === EMAIL SENDING ===
+	// Uploaded files only live as long as this request, so those
+	// submissions are always sent before answering
+	if merges != nil && len(atts) == 0 && !cfg.MaintenanceMode {
+		merges.add(sub, cfg.MergeWindow)
+		sentRef = sub.ID
+		// Clients only expect a 202 when they opted into ASYNC_SEND
+		if cfg.AsyncSend {
+			writeAccepted(w, r, sub)
+		} else {
+			writeSuccess(w, r, sub.ID, &sub.Form)
+		}
+		return
+	}
+	if sendQueue != nil && len(atts) == 0 && !cfg.MaintenanceMode {
+		if enqueueSend(sub) {
+			sentRef = sub.ID
+			writeAccepted(w, r, sub)
+			return
+		}
+		log.Printf("Send queue full, sending %s synchronously", sub.ID)
+	}
+	err := deliverSubmission(r.Context(), sub, atts)
+	if errors.Is(err, errMaintenanceMode) {
+		sentRef = sub.ID
+		writeSuccessMessage(w, r, sub.ID, &sub.Form, cfg.MaintenanceMessage)
+		return
+	}
+	if errors.Is(err, errDailyCapReached) {
+		if cfg.DailySendCapStatus == http.StatusServiceUnavailable {
+			// The visitor is asked to resubmit, so the retry worker must
+			// not send this one after midnight as well
+			recordSubmission(sub, statusReceived, errDailyCapReached)
+			writeError(w, r, http.StatusServiceUnavailable, "Service temporarily unavailable, please try again later")
+			return
+		}
+		// The submission is stored, so the visitor sees the usual success
+		sentRef = sub.ID
+		writeSuccess(w, r, sub.ID, &sub.Form)
+		return
+	}
+	if err != nil && cfg.RetryMaxAttempts > 0 {
+		// The retry worker resends it, so the visitor must not resubmit
+		log.Printf("Submission %s queued for retry", sub.ID)
+		sentRef = sub.ID
+		writeAccepted(w, r, sub)
+		return
+	}
 	if err != nil {
-		log.Printf("Email send error: %v", err)
-		http.Error(w, "Failed to send email", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, "Failed to send email")
 		return
 	}
+	sentRef = sub.ID
+
+	if cfg.AutoReply {
+		go sendAutoReply(sub)
+	}
 
 	// SUCCESS RESPONSE
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	writeSuccess(w, r, sub.ID, &sub.Form)
 }
 
-// Validate reCAPTCHA v3 token
-func verifyRecaptcha(token string) bool {
-	secret := os.Getenv("RECAPTCHA_SECRET")
-	if secret == "" {
-		log.Println("Missing RECAPTCHA_SECRET")
-		return false
-	}
+var errMaintenanceMode = errors.New("sending paused by MAINTENANCE_MODE")
 
-	resp, err := http.PostForm("https://www.google.com/recaptcha/api/siteverify",
-		map[string][]string{
-			"secret":   {secret},
-			"response": {token},
-		},
-	)
+// Send the team notification for sub, with any uploaded files, and
+// record the outcome
+func deliverSubmission(ctx context.Context, sub *Submission, atts []*attachment) error {
+	return deliverSubmissions(ctx, []*Submission{sub}, atts)
+}
+
+// Like deliverSubmission for submissions merged into one notification;
+// each of them is recorded with the outcome
+func deliverSubmissions(ctx context.Context, subs []*Submission, atts []*attachment) error {
+	cfg := currentConfig()
+	sub := subs[len(subs)-1]
+	record := func(status string, err error) {
+		for _, s := range subs {
+			recordSubmission(s, status, err)
+		}
+	}
+	if cfg.MaintenanceMode {
+		if len(atts) > 0 {
+			log.Printf("Submission %s deferred; its %d attachment(s) will not be included", sub.ID, len(atts))
+		}
+		record(statusDeferred, nil)
+		return errMaintenanceMode
+	}
+	if !dailySends.take(cfg.DailySendCap, time.Now()) {
+		log.Printf("Submission %s stored without email: %v", sub.ID, errDailyCapReached)
+		record(statusCapped, errDailyCapReached)
+		return errDailyCapReached
+	}
+	_, sendSpan := tracer.Start(ctx, "smtp.send")
+	start := time.Now()
+	notification := newNotification(sub)
+	if len(subs) > 1 {
+		notification = newMergedNotification(subs)
+	}
+	notification.Attachments = atts
+	err := sendMail(notification)
+	elapsed := time.Since(start)
+	endSpan(sendSpan, err)
+	smtpSendDuration.observe(elapsed.Seconds())
+	if elapsed > cfg.SlowSendThreshold {
+		log.Printf("Slow email send for %s: took %s (threshold %s)", sub.ID, elapsed, cfg.SlowSendThreshold)
+	}
 	if err != nil {
-		log.Println("reCAPTCHA HTTP error:", err)
-		return false
+		log.Printf("Email send error: %v", err)
+		sendStats.recordFailure(err)
+		record(statusFailed, err)
+		return err
 	}
-	defer resp.Body.Close()
+	sendStats.recordSuccess()
+	record(statusSent, nil)
+	return nil
+}
 
-	body, _ := io.ReadAll(resp.Body)
+// Success response for a submission that is dropped without a trace, so
+// bots can't tell it apart from a real one; only the audit log records
+// it as dropped for reason
+func writeDecoySuccess(w http.ResponseWriter, r *http.Request, cfg *Config, form ContactForm, reason string) {
+	auditDropped(r.Context(), reason)
+	form.Locale = resolveLocale(cfg, form.Locale, r)
+	decoy := newSubmission(form)
+	writeSuccess(w, r, decoy.ID, &decoy.Form)
+}
 
-	var result RecaptchaResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		log.Println("reCAPTCHA parse error:", err)
-		return false
+// Success response echoing the form as stored, after normalization and
+// without the reCAPTCHA token. The echo is left out when echo is nil, as
+// for an idempotent replay.
+func writeSuccess(w http.ResponseWriter, r *http.Request, ref string, echo *ContactForm) {
+	writeSuccessMessage(w, r, ref, echo, "")
+}
+
+// Success response with a message for the visitor, e.g. that sending is
+// paused; plain writeSuccess when message is empty
+func writeSuccessMessage(w http.ResponseWriter, r *http.Request, ref string, echo *ContactForm, message string) {
+	if prefersText(r) {
+		if message == "" {
+			message = "Message sent."
+		}
+		writeText(w, http.StatusOK, "%s Reference: %s", message, ref)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(successBody("success", ref, echo, message))
+}
+
+// Success payload presets (SUCCESS_RESPONSE)
+const (
+	// {"status":"success","referenceId":...,"submission":{...}}
+	successShapeStandard = "standard"
+	// {"success":true,"id":...}, without the echo
+	successShapeCompact = "compact"
+)
 
-	log.Println("reCAPTCHA score:", result.Score)
-	return result.Success && result.Score > 0.5
+// Success payload in the configured shape; status is "success" or
+// "accepted" and only shows in the standard shape, as the HTTP status
+// already tells them apart
+func successBody(status, ref string, echo *ContactForm, message string) map[string]any {
+	var resp map[string]any
+	if currentConfig().SuccessResponse == successShapeCompact {
+		resp = map[string]any{"success": true, "id": ref}
+	} else {
+		resp = map[string]any{"status": status, "referenceId": ref}
+		if echo != nil {
+			resp["submission"] = echo
+		}
+	}
+	if message != "" {
+		resp["message"] = message
+	}
+	return resp
 }
 
 func main() {
-	// sending test mail to verify SMTP settings
-	if err := sendTestMail(); err != nil {
-		log.Println("Test mail failed:", err)
+	checkOnly := flag.Bool("check", false, "validate configuration, print a JSON report and exit")
+	testMailTo := flag.String("test-mail", "", "send a test email to this address and exit")
+	flag.Parse()
+
+	cfg, err := loadConfig()
+	if *checkOnly {
+		rep := checkConfig(cfg, err)
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(rep)
+		if !rep.OK {
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	activeConfig.Store(cfg)
+	if *testMailTo != "" {
+		if _, err := mail.ParseAddress(*testMailTo); err != nil {
+			log.Fatal("-test-mail: ", err)
+		}
+		if err := sendTestMail(*testMailTo); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if cfg.AppEnv == "" {
+		log.Println("APP_ENV not set, starting without production checks")
 	} else {
-		log.Println("Test mail sent successfully")
+		log.Printf("Starting in %s mode", cfg.AppEnv)
+	}
+	if len(cfg.CaptchaBypass) > 0 {
+		log.Printf("WARNING: reCAPTCHA is bypassed for %v", cfg.CaptchaBypass)
 	}
 
-	http.Handle("/api/contact", corsMiddleware(http.HandlerFunc(contactHandler)))
+	if cfg.OverrideRecipient != "" {
+		log.Printf("All mail is redirected to %s", cfg.OverrideRecipient)
+	}
+	if cfg.MailDryRun {
+		log.Println("Mail dry-run enabled, emails will be logged instead of sent")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	seenTokens = newTTLCache[struct{}](cfg.RecaptchaReplayWindow)
+	if cfg.IdempotencyWindow > 0 {
+		idempotencyKeys = newTTLCache[string](cfg.IdempotencyWindow)
+	}
+	if cfg.RateLimit > 0 {
+		limiter = newRateLimiter(cfg.RateLimitWindow)
+	}
+	verifyLimiter = newRateLimiter(cfg.RateLimitWindow)
+	if cfg.FormTokenSecret != "" {
+		// Without FORM_MAX_FILL_TIME tokens never expire; a day still
+		// stops them being replayed in a burst
+		spent := cfg.FormMaxFillTime
+		if spent == 0 {
+			spent = 24 * time.Hour
+		}
+		spentFormTokens = newTTLCache[struct{}](spent)
+	}
+	if len(cfg.DNSBLZones) > 0 {
+		dnsblCache = newTTLCache[bool](cfg.DNSBLCacheTTL)
+	}
+	if cfg.CheckMX {
+		mxCache = newTTLCache[bool](cfg.MXCacheTTL)
+	}
+
+	if cfg.AuditLogFile != "" {
+		a, err := openAuditLog(cfg.AuditLogFile, cfg.AuditLogMaxBytes, cfg.AuditLogKeep)
+		if err != nil {
+			log.Fatal("Audit log: ", err)
+		}
+		auditLog = a
+	}
+	recaptchaClient.Timeout = cfg.RecaptchaTimeout
+	if cfg.RecaptchaMaxConcurrent > 0 {
+		captchaSlots = make(chan struct{}, cfg.RecaptchaMaxConcurrent)
+	}
+	if cfg.SMTPPoolSize > 0 {
+		smtpConns = newSMTPPool(cfg.SMTPPoolSize, cfg.SMTPPoolIdleTimeout)
+	}
+	if len(cfg.WebhookURLs) > 0 {
+		webhooks = newWebhookQueue(cfg.WebhookQueueSize, cfg.WebhookTimeout)
+	}
+	if cfg.AsyncSend && cfg.Mode == modeEmail {
+		sendQueue = make(chan *Submission, cfg.SendQueueSize)
+	}
+	if cfg.MergeWindow > 0 && cfg.Mode == modeEmail {
+		merges = newMergeBuffer()
+	}
+
+	if cfg.EmailTemplateDir != "" {
+		t, err := loadTemplates(cfg.EmailTemplateDir)
+		if err != nil {
+			log.Fatal("Email templates: ", err)
+		}
+		activeTemplates.Store(t)
+	}
+
+	if cfg.SubmissionsDir != "" {
+		fs, err := newFileStore(cfg.SubmissionsDir)
+		if err != nil {
+			log.Fatal("Submission store: ", err)
+		}
+		store = fs
+	} else {
+		ms := newMemoryStore(cfg.SubmissionRetention)
+		registerSweeper(ms)
+		store = ms
+	}
+	sweepHeldSubmissions()
+
+	if cfg.SheetsID != "" {
+		sc, err := newSheetsClient(cfg.SheetsCredentialsFile, cfg.SheetsID, cfg.SheetsRange)
+		if err != nil {
+			log.Fatal("Google Sheets: ", err)
+		}
+		sheets = sc
+	}
+
+	if cfg.DisposableDomainsURL != "" {
+		go refreshDisposableDomains(ctx, cfg.DisposableDomainsURL, cfg.DisposableDomainsRefresh)
+	}
+
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		log.Fatal("OpenTelemetry: ", err)
+	}
+
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		runJanitor(ctx, cfg.CleanupInterval)
+	}()
+	if webhooks != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			webhooks.run(ctx)
+		}()
+	}
+	if sendQueue != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			runSendWorker(ctx)
+		}()
+	}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		runRetryWorker(ctx, cfg.RetryInterval)
+	}()
+	if cfg.EmailTemplateWatch {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			watchTemplates(ctx, cfg.EmailTemplateDir)
+		}()
+	}
+
+	// sending test mail to verify SMTP settings, in the background so a
+	// slow SMTP server doesn't hold up the listener; see /status
+	if cfg.Mode != modeEmail {
+		log.Printf("MODE=%s: submissions are not emailed", cfg.Mode)
+	} else {
+		go func() {
+			err := sendTestMail(defaultTestMailRecipient)
+			if err != nil {
+				log.Println("Test mail failed:", err)
+			}
+			sendStats.recordSelfTest(err)
+		}()
+	}
+
+	http.Handle("/api/contact", formRulesMiddleware(corsMiddleware(minDelayMiddleware(auditMiddleware("contact", traceMiddleware("contact.submit", http.HandlerFunc(contactHandler)))), http.MethodPost)))
+	http.Handle("/api/verify-captcha", corsMiddleware(traceMiddleware("captcha.verify", http.HandlerFunc(verifyCaptchaHandler)), http.MethodPost))
+	http.Handle("/api/contact/token", corsMiddleware(http.HandlerFunc(formTokenHandler), http.MethodGet))
+	// Earlier name of the token endpoint
+	http.Handle("/api/contact/form-token", corsMiddleware(http.HandlerFunc(formTokenHandler), http.MethodGet))
+	http.Handle("/api/contact/status/{id}", corsMiddleware(http.HandlerFunc(submissionStatusHandler), http.MethodGet))
+	http.Handle("/api/contact/batch", requireAPIKey(traceMiddleware("contact.batch", http.HandlerFunc(batchHandler))))
+	http.HandleFunc("/metrics", metricsHandler)
+	http.HandleFunc("/status", statusHandler)
+	http.Handle("/config-check", requireAdmin(http.HandlerFunc(configCheckHandler)))
+	http.Handle("/reload", requireAdmin(http.HandlerFunc(reloadHandler)))
+	http.Handle("/debug/config", requireAdmin(http.HandlerFunc(debugConfigHandler)))
+	http.Handle("/api/preview", requireAdmin(http.HandlerFunc(previewHandler)))
+	if cfg.SyntheticEndpoint {
+		log.Println("Synthetic submissions enabled on /api/contact/synthetic")
+		http.Handle("/api/contact/synthetic", requireAdmin(minDelayMiddleware(auditMiddleware("contact.synthetic", traceMiddleware("contact.synthetic", http.HandlerFunc(syntheticHandler))))))
+	}
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
-	fmt.Println("Server running on port", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	srv := &http.Server{
+		Addr:              ":" + port,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	srv.SetKeepAlivesEnabled(cfg.KeepAlive)
+	go func() {
+		var err error
+		if cfg.TLSCertFile != "" {
+			fmt.Println("Server running on port", port, "(HTTPS)")
+			err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			fmt.Println("Server running on port", port)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), currentConfig().ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("HTTP shutdown error:", err)
+	}
+	workers.Wait()
+	if sendQueue != nil {
+		drainSendQueue(shutdownCtx)
+	}
+	if merges != nil {
+		merges.flushAll(shutdownCtx)
+	}
+	if webhooks != nil {
+		webhooks.close()
+	}
+	if smtpConns != nil {
+		smtpConns.close()
+	}
+	if auditLog != nil {
+		auditLog.close()
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Println("Trace flush error:", err)
+	}
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
+// CORS for a route accepting the given methods. Preflights are answered
+// here, and rejected with 405 when they ask for a method the route
+// doesn't accept.
+func corsMiddleware(next http.Handler, methods ...string) http.Handler {
+	allow := strings.Join(append(methods, http.MethodOptions), ", ")
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow requests from your frontend domain
+		// Allow requests from your frontend domain. Requests without an
+		// Origin don't come from a browser, so they get no CORS headers;
+		// Vary still marks that the answer depends on it.
+		cfg := currentConfig()
 		origin := r.Header.Get("Origin")
-		if origin == "http://localhost:3000" ||
-			origin == "https://next-kiosk.com" ||
-			origin == "https://next-kiosk.netlify.app" ||
-			origin == "http://next-kiosk.netlify.app" {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+		if origin != "" {
+			if slices.Contains(cfg.AllowedOrigins, origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			} else if !cfg.CORSCredentials && slices.Contains(cfg.AllowedOrigins, "*") {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+			w.Header().Set("Access-Control-Allow-Methods", allow)
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+			w.Header().Set("Access-Control-Expose-Headers", "Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-Request-ID, X-Captcha-Step-Up, X-Form-Rules")
+			if cfg.CORSCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
 		}
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", allow)
+			// A script's own OPTIONS request is preflighted too
+			if m := r.Header.Get("Access-Control-Request-Method"); m != "" && m != http.MethodOptions && !slices.Contains(methods, m) {
+				debugf("Preflight for %s %s rejected", m, r.URL.Path)
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -166,40 +768,77 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func sendTestMail() error {
-	from := os.Getenv("SMTP_EMAIL")
-	password := os.Getenv("SMTP_PASSWORD")
-	to := "nextkiosksolutions@gmail.com"
+// Receives the startup test mail
+const defaultTestMailRecipient = "nextkiosksolutions@gmail.com"
+
+func sendTestMail(to string) error {
+	from := currentConfig().SMTPEmail
+	rcpt := &mail.Address{Address: to}
 
 	subject := "✅ Mail System Check - Next Kiosk"
-	body := fmt.Sprintf("Mail functionality has been deployed and it's working. Time: %s", time.Now().Format("2006-01-02 15:04:05"))
+	body := fmt.Sprintf("Mail functionality has been deployed and it's working. Time: %s", localTime(time.Now()).Format("2006-01-02 15:04:05 MST"))
 
 	msg := []byte(
 		"From: Next Kiosk <" + from + ">\r\n" +
-			"To: Muhammet Aydın <" + to + ">\r\n" +
-			"Subject: " + subject + "\r\n" +
+			"To: " + rcpt.String() + "\r\n" +
+			"Subject: " + encodeHeader(subject) + "\r\n" +
 			"Date: " + formatDateRFC5322() + "\r\n" +
 			"MIME-Version: 1.0\r\n" +
 			"Content-Type: text/plain; charset=UTF-8\r\n" +
 			"Content-Transfer-Encoding: 7bit\r\n" +
 			"\r\n" + body)
 
-	auth := smtp.PlainAuth("", from, password, "smtpout.secureserver.net")
-
-	err := smtp.SendMail("smtpout.secureserver.net:587", auth, from, []string{to}, msg)
+	err := activeMailer().Send(currentConfig().SMTPEnvelopeFrom, []string{to}, msg)
 	if err != nil {
 		log.Printf("smtp.SendMail failed: %v", err)
 		return fmt.Errorf("failed to send test mail: %w", err)
 	}
+	if currentConfig().MailDryRun {
+		log.Printf("MAIL_DRY_RUN is on: the test mail to %s was only logged, nothing was sent", to)
+		return nil
+	}
 	log.Println("✅ Test mail sent successfully to", to)
 	return nil
 }
 
 func formatDateRFC5322() string {
-	return time.Now().Format("Mon, 02 Jan 2006 15:04:05 -0700")
+	return localTime(time.Now()).Format("Mon, 02 Jan 2006 15:04:05 -0700")
+}
+
+// Convert t to the configured display timezone (TZ_DISPLAY)
+func localTime(t time.Time) time.Time {
+	cfg := currentConfig()
+	if cfg == nil || cfg.DisplayLocation == nil {
+		return t.UTC()
+	}
+	return t.In(cfg.DisplayLocation)
 }
 
+// JSON name for the Go type a field expected
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// Log only when verbose logging is enabled
+func debugf(format string, args ...any) {
+	if cfg := currentConfig(); cfg != nil && cfg.Verbose {
+		log.Printf(format, args...)
+	}
+}
+
+var emailRegexp = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}$`)
+
 func isValidEmail(email string) bool {
-	reg := regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}$`)
-	return reg.MatchString(email)
+	return emailRegexp.MatchString(email)
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records messages instead of sending them
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []sentMessage
+}
+
+type sentMessage struct {
+	from string
+	to   []string
+	msg  []byte
+}
+
+func (m *recordingMailer) Send(from string, to []string, msg []byte) error {
+	m.mu.Lock()
+	m.sent = append(m.sent, sentMessage{from, to, msg})
+	m.mu.Unlock()
+	return nil
+}
+
+// Configure the package for a test: a siteverify stub that accepts every
+// token with the given score, a recording mailer and fresh stores.
+func setupTestServer(t *testing.T, score float64) (*httptest.Server, *recordingMailer) {
+	t.Helper()
+
+	verify := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("secret") != "test-secret" || r.FormValue("response") == "" {
+			json.NewEncoder(w).Encode(RecaptchaResponse{Success: false})
+			return
+		}
+		json.NewEncoder(w).Encode(RecaptchaResponse{
+			Success:     true,
+			Score:       score,
+			ChallengeTS: time.Now().UTC().Format(time.RFC3339),
+		})
+	}))
+	t.Cleanup(verify.Close)
+
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("APP_ENV", envDevelopment)
+	t.Setenv("MAIL_DRY_RUN", "false")
+	t.Setenv("SMTP_EMAIL", "noreply@next-kiosk.com")
+	t.Setenv("RECAPTCHA_SECRET", "test-secret")
+	t.Setenv("RECAPTCHA_VERIFY_URL", verify.URL)
+	t.Setenv("CONTACT_RECIPIENT", "sales@next-kiosk.com")
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	prevConfig := activeConfig.Swap(cfg)
+	t.Cleanup(func() { activeConfig.Store(prevConfig) })
+
+	rec := &recordingMailer{}
+	prevMailer, prevStore := mailer, store
+	mailer, store = rec, newMemoryStore(0)
+	seenTokens = newTTLCache[struct{}](cfg.RecaptchaReplayWindow)
+	t.Cleanup(func() { mailer, store = prevMailer, prevStore })
+
+	srv := httptest.NewServer(corsMiddleware(traceMiddleware("contact.submit", http.HandlerFunc(contactHandler)), http.MethodPost))
+	t.Cleanup(srv.Close)
+	return srv, rec
+}
+
+func postContact(t *testing.T, srv *httptest.Server, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+const validSubmission = `{
+	"firstName": "Jane",
+	"lastName": "Doe",
+	"email": "Jane.Doe@Example.org",
+	"phone": "+90 555 000 0000",
+	"company": "Example Ltd",
+	"message": "We would like a quote for 3 kiosks.",
+	"recaptchaToken": "token-1"
+}`
+
+func TestContactSubmissionEndToEnd(t *testing.T) {
+	srv, rec := setupTestServer(t, 0.9)
+
+	resp := postContact(t, srv, validSubmission)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("status = %d, body %q", resp.StatusCode, body)
+	}
+	var got struct {
+		Status      string      `json:"status"`
+		ReferenceID string      `json:"referenceId"`
+		Submission  ContactForm `json:"submission"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Status != "success" || len(got.ReferenceID) != 8 {
+		t.Fatalf("unexpected response %+v", got)
+	}
+	if got.Submission.Email != "jane.doe@example.org" || got.Submission.Token != "" {
+		t.Errorf("echoed submission not normalized/sanitized: %+v", got.Submission)
+	}
+
+	if len(rec.sent) != 1 {
+		t.Fatalf("mailer received %d messages, want 1", len(rec.sent))
+	}
+	sent := rec.sent[0]
+	if sent.from != "noreply@next-kiosk.com" {
+		t.Errorf("envelope from = %q", sent.from)
+	}
+	if len(sent.to) != 1 || sent.to[0] != "sales@next-kiosk.com" {
+		t.Errorf("envelope to = %v", sent.to)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(sent.msg)))
+	if err != nil {
+		t.Fatalf("message is not well-formed: %v", err)
+	}
+	if subject := msg.Header.Get("Subject"); !strings.Contains(subject, got.ReferenceID) {
+		t.Errorf("subject %q does not carry reference %s", subject, got.ReferenceID)
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date header: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v", msg.Header.Get("Content-Type"), err)
+	}
+	parts := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		data, _ := io.ReadAll(part)
+		parts[partType] = string(data)
+	}
+	for _, partType := range []string{"text/plain", "text/html"} {
+		body, ok := parts[partType]
+		if !ok {
+			t.Errorf("no %s part", partType)
+			continue
+		}
+		for _, want := range []string{got.ReferenceID, "Jane Doe", "jane.doe@example.org", "We would like a quote for 3 kiosks."} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s part does not contain %q:\n%s", partType, want, body)
+			}
+		}
+	}
+
+	stored, err := store.Get(got.ReferenceID)
+	if err != nil || stored.Status != statusSent {
+		t.Errorf("stored submission = %+v, %v", stored, err)
+	}
+}
+
+func TestContactSubmissionRejectsLowScore(t *testing.T) {
+	srv, rec := setupTestServer(t, 0.1)
+
+	resp := postContact(t, srv, validSubmission)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", resp.StatusCode)
+	}
+	if len(rec.sent) != 0 {
+		t.Errorf("mailer received %d messages, want none", len(rec.sent))
+	}
+}
+
+func TestContactSubmissionTokenSpentOnlyWhenAccepted(t *testing.T) {
+	srv, rec := setupTestServer(t, 0.9)
+
+	invalid := strings.Replace(validSubmission, `"Jane.Doe@Example.org"`, `"not-an-email"`, 1)
+	if resp := postContact(t, srv, invalid); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid submission: status = %d, want 400", resp.StatusCode)
+	}
+	if resp := postContact(t, srv, validSubmission); resp.StatusCode != http.StatusOK {
+		t.Fatalf("corrected submission: status = %d, want 200", resp.StatusCode)
+	}
+	if resp := postContact(t, srv, validSubmission); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("replayed submission: status = %d, want 401", resp.StatusCode)
+	}
+	if len(rec.sent) != 1 {
+		t.Errorf("mailer received %d messages, want 1", len(rec.sent))
+	}
+}
+
+func TestContactSubmissionFormTokenSingleUse(t *testing.T) {
+	t.Setenv("FORM_TOKEN_SECRET", "form-secret")
+	t.Setenv("FORM_MIN_FILL_TIME", "0s")
+	srv, rec := setupTestServer(t, 0.9)
+	spentFormTokens = newTTLCache[struct{}](time.Hour)
+	t.Cleanup(func() { spentFormTokens = nil })
+
+	token := signFormToken("form-secret", time.Now())
+	submission := func(captcha, email string) string {
+		return fmt.Sprintf(`{"firstName": "Jane", "lastName": "Doe", "email": %q, "message": "We would like a quote.", "recaptchaToken": %q, "formToken": %q}`, email, captcha, token)
+	}
+	if resp := postContact(t, srv, submission("token-1", "not-an-email")); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid submission: status = %d, want 400", resp.StatusCode)
+	}
+	if resp := postContact(t, srv, submission("token-2", "jane@example.org")); resp.StatusCode != http.StatusOK {
+		t.Fatalf("corrected submission: status = %d, want 200", resp.StatusCode)
+	}
+	if resp := postContact(t, srv, submission("token-3", "jane@example.org")); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("reused form token: status = %d, want 403", resp.StatusCode)
+	}
+	if len(rec.sent) != 1 {
+		t.Errorf("mailer received %d messages, want 1", len(rec.sent))
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Submissions held back with MERGE_WINDOW so rapid follow-ups from one
+// sender go out as a single notification; nil when merging is off
+var merges *mergeBuffer
+
+type mergeBuffer struct {
+	mu      sync.Mutex
+	pending map[string][]*Submission
+	// Set by flushAll; a window expiring after that leaves its group to it
+	closed bool
+	// Flushes started by expiring windows, waited for by flushAll
+	flushing sync.WaitGroup
+}
+
+func newMergeBuffer() *mergeBuffer {
+	return &mergeBuffer{pending: map[string][]*Submission{}}
+}
+
+// Address used to group submissions: lower-cased and without a +tag, so
+// jane+test@x and Jane@x count as one sender
+func canonicalEmail(addr string) string {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok {
+		return addr
+	}
+	local, _, _ = strings.Cut(local, "+")
+	return local + "@" + domain
+}
+
+// Submissions only merge when they would go to the same recipients
+func mergeKey(sub *Submission) string {
+	return canonicalEmail(sub.Form.Email) + "\x00" + sub.Form.FormType + "\x00" + sub.Origin
+}
+
+// Hold sub until the window opened by the first submission from the same
+// sender expires. The window doesn't slide, so nothing waits longer than
+// MERGE_WINDOW however often the sender resubmits. It is stored as held,
+// so a crash before the flush leaves it for sweepHeldSubmissions.
+func (m *mergeBuffer) add(sub *Submission, window time.Duration) {
+	recordSubmission(sub, statusHeld, nil)
+	key := mergeKey(sub)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if subs, ok := m.pending[key]; ok {
+		m.pending[key] = append(subs, sub)
+		debugf("Submission %s merged with %d earlier one(s)", sub.ID, len(subs))
+		return
+	}
+	m.pending[key] = []*Submission{sub}
+	time.AfterFunc(window, func() { m.expire(key) })
+}
+
+// Flush key once its window is over, unless shutdown has taken over
+func (m *mergeBuffer) expire(key string) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.flushing.Add(1)
+	m.mu.Unlock()
+	defer m.flushing.Done()
+	m.flush(context.Background(), key)
+}
+
+// Send one notification for everything held under key
+func (m *mergeBuffer) flush(ctx context.Context, key string) {
+	m.mu.Lock()
+	subs := m.pending[key]
+	delete(m.pending, key)
+	m.mu.Unlock()
+	if len(subs) == 0 {
+		return
+	}
+	if ctx.Err() != nil {
+		for _, sub := range subs {
+			recordSubmission(sub, statusFailed, errShutdownUnsent)
+		}
+		return
+	}
+	// One confirmation per merged notification, for the latest version
+	if err := deliverSubmissions(ctx, subs, nil); err == nil && currentConfig().AutoReply {
+		sendAutoReply(subs[len(subs)-1])
+	}
+}
+
+// Send every held group at shutdown until ctx expires; later groups are
+// stored as failed in SUBMISSIONS_DIR for a resend after restart. Flushes
+// already under way are waited for.
+func (m *mergeBuffer) flushAll(ctx context.Context) {
+	m.mu.Lock()
+	m.closed = true
+	keys := make([]string, 0, len(m.pending))
+	for key := range m.pending {
+		keys = append(keys, key)
+	}
+	m.mu.Unlock()
+	for _, key := range keys {
+		m.flush(ctx, key)
+	}
+	m.flushing.Wait()
+	if len(keys) > 0 {
+		log.Printf("Flushed %d held submission group(s)", len(keys))
+	}
+}
+
+// Hand submissions left held by a crash to the retry worker, which sends
+// each on its own. Runs at startup, before anything is held again.
+func sweepHeldSubmissions() {
+	held, err := store.List(statusHeld)
+	if err != nil {
+		log.Println("Listing held submissions:", err)
+		return
+	}
+	for _, sub := range held {
+		recordSubmission(sub, statusDeferred, nil)
+	}
+	if len(held) > 0 {
+		log.Printf("%d submission(s) left held for merging by the last run, deferred for the retry worker", len(held))
+	}
+}
+
+// One notification covering several submissions, newest last. It is
+// addressed and titled like the newest one and stays plain text, since
+// the HTML layout only describes a single submission.
+func newMergedNotification(subs []*Submission) *Email {
+	last := subs[len(subs)-1]
+	e := newNotification(last)
+	e.Subject += fmt.Sprintf(" (%d submissions)", len(subs))
+	var b strings.Builder
+	for i, sub := range subs {
+		fmt.Fprintf(&b, "\n---- Submission %d of %d ----\n", i+1, len(subs))
+		b.WriteString(notificationText(sub))
+	}
+	e.Body = withFooter(wrapText(b.String(), currentConfig().MailWrapColumn))
+	e.HTML = ""
+	e.Inline = nil
+	return e
+}
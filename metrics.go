@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Minimal Prometheus text-format metrics, enough for a handful of
+// histograms without pulling in the client library
+
+type metric interface {
+	writeTo(w io.Writer)
+}
+
+var (
+	metricsMu sync.Mutex
+	registry  []metric
+)
+
+func register(m metric) {
+	metricsMu.Lock()
+	registry = append(registry, m)
+	metricsMu.Unlock()
+}
+
+var smtpSendDuration = newHistogram(
+	"contact_smtp_send_duration_seconds",
+	"Time spent sending the notification email over SMTP.",
+	[]float64{0.25, 0.5, 1, 2, 5, 10, 20, 30, 60},
+	[]float64{0.5, 0.95},
+)
+
+// Every score siteverify returns for a valid token, above the threshold
+// or not, for tuning RECAPTCHA_MIN_SCORE
+var captchaScores = newHistogram(
+	"contact_recaptcha_score",
+	"reCAPTCHA scores returned by siteverify.",
+	[]float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1},
+	nil,
+)
+
+// Number of recent observations kept for quantile estimates
+const histogramWindow = 1024
+
+type histogram struct {
+	name      string
+	help      string
+	buckets   []float64
+	quantiles []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+	recent []float64
+	next   int
+}
+
+func newHistogram(name, help string, buckets, quantiles []float64) *histogram {
+	h := &histogram{
+		name:      name,
+		help:      help,
+		buckets:   buckets,
+		quantiles: quantiles,
+		counts:    make([]uint64, len(buckets)),
+	}
+	register(h)
+	return h
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+
+	if len(h.recent) < histogramWindow {
+		h.recent = append(h.recent, v)
+	} else {
+		h.recent[h.next] = v
+		h.next = (h.next + 1) % histogramWindow
+	}
+}
+
+// quantile of the recent window; callers must hold h.mu
+func (h *histogram) quantile(q float64) float64 {
+	if len(h.recent) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), h.recent...)
+	sort.Float64s(sorted)
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+func (h *histogram) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(b), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.name, formatFloat(h.sum), h.name, h.count)
+
+	if len(h.quantiles) == 0 {
+		return
+	}
+	name := h.name + "_recent"
+	fmt.Fprintf(w, "# HELP %s Quantiles over the last %d observations.\n# TYPE %s gauge\n", name, histogramWindow, name)
+	for _, q := range h.quantiles {
+		fmt.Fprintf(w, "%s{quantile=\"%s\"} %s\n", name, formatFloat(q), formatFloat(h.quantile(q)))
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	for _, m := range registry {
+		m.writeTo(w)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+)
+
+// A part referenced from the HTML body by cid: URL, such as the logo
+type inlinePart struct {
+	ContentID   string
+	ContentType string
+	Filename    string
+	Data        []byte
+}
+
+// RFC 2047 encode a header value if it has non-ASCII characters, so
+// subjects with names like "Şirin Yazılım" don't arrive as mojibake.
+// ASCII values are returned unchanged.
+func encodeHeader(v string) string {
+	return mime.QEncoding.Encode("utf-8", v)
+}
+
+// Content-Transfer-Encoding values
+const (
+	encoding7bit            = "7bit"
+	encodingQuotedPrintable = "quoted-printable"
+	encodingBase64          = "base64"
+)
+
+// Encode a text body for transfer. Pure ASCII with lines short enough
+// for SMTP goes as-is; anything else (accents, emoji) uses
+// MAIL_BODY_ENCODING so it survives relays that aren't 8-bit clean.
+func encodeText(text string) (string, []byte) {
+	if is7bit(text) {
+		return encoding7bit, []byte(text)
+	}
+	var buf bytes.Buffer
+	if currentConfig().MailBodyEncoding == encodingBase64 {
+		writeBase64(&buf, []byte(text))
+		return encodingBase64, buf.Bytes()
+	}
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(text))
+	qp.Close()
+	return encodingQuotedPrintable, buf.Bytes()
+}
+
+func is7bit(s string) bool {
+	for line := range strings.Lines(s) {
+		if len(line) > 998 {
+			return false
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 || s[i] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Content-Type header value, transfer encoding and encoded body for the
+// message content. With attachments the body becomes the first part of a
+// multipart/mixed message.
+func (e *Email) content() (ctype, cte string, body []byte, err error) {
+	ctype, cte, body = e.bodyContent()
+	if len(e.Attachments) == 0 {
+		return ctype, cte, body, nil
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	header := textproto.MIMEHeader{"Content-Type": {ctype}}
+	if cte != "" {
+		header.Set("Content-Transfer-Encoding", cte)
+	}
+	part, _ := w.CreatePart(header)
+	part.Write(body)
+	for _, a := range e.Attachments {
+		if err := writeAttachmentPart(w, a); err != nil {
+			return "", "", nil, fmt.Errorf("attachment %q: %w", a.Filename, err)
+		}
+	}
+	w.Close()
+	return "multipart/mixed; boundary=" + w.Boundary(), "", buf.Bytes(), nil
+}
+
+func writeAttachmentPart(w *multipart.Writer, a *attachment) error {
+	r, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	part, _ := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {a.ContentType},
+		"Content-Transfer-Encoding": {encodingBase64},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+	})
+	return copyBase64(part, r)
+}
+
+// Plain text stays a single part; with HTML the text becomes the
+// multipart/alternative fallback, wrapped in multipart/related when
+// there are inline images.
+func (e *Email) bodyContent() (ctype, cte string, body []byte) {
+	if e.HTML == "" {
+		cte, body := encodeText(e.Body)
+		return "text/plain; charset=UTF-8", cte, body
+	}
+	altType, alt := alternativePart(e.Body, e.HTML)
+	if len(e.Inline) == 0 {
+		return altType, "", alt
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	part, _ := w.CreatePart(textproto.MIMEHeader{"Content-Type": {altType}})
+	part.Write(alt)
+	for _, img := range e.Inline {
+		part, _ := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {img.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + img.ContentID + ">"},
+			"Content-Disposition":       {mime.FormatMediaType("inline", map[string]string{"filename": img.Filename})},
+		})
+		writeBase64(part, img.Data)
+	}
+	w.Close()
+	return fmt.Sprintf("multipart/related; type=\"multipart/alternative\"; boundary=%s", w.Boundary()), "", buf.Bytes()
+}
+
+func alternativePart(text, html string) (string, []byte) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	cte, body := encodeText(text)
+	part, _ := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=UTF-8"},
+		"Content-Transfer-Encoding": {cte},
+	})
+	part.Write(body)
+
+	part, _ = w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	qp := quotedprintable.NewWriter(part)
+	qp.Write([]byte(html))
+	qp.Close()
+
+	w.Close()
+	return "multipart/alternative; boundary=" + w.Boundary(), buf.Bytes()
+}
+
+// Base64 with the 76-column lines RFC 2045 requires
+func writeBase64(w io.Writer, data []byte) {
+	copyBase64(w, bytes.NewReader(data))
+}
+
+// Like writeBase64, streaming from r so files are never read into
+// memory whole
+func copyBase64(w io.Writer, r io.Reader) error {
+	enc := base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: w, width: 76})
+	if _, err := io.Copy(enc, r); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
+
+// Breaks what is written through it into lines of width bytes; the
+// last line is left open
+type lineWrapper struct {
+	w     io.Writer
+	width int
+	col   int
+}
+
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		if l.col == l.width {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return n, err
+			}
+			l.col = 0
+		}
+		m, err := l.w.Write(p[:min(len(p), l.width-l.col)])
+		n += m
+		l.col += m
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+)
+
+// Domain lookups with CHECK_MX, cached for MX_CACHE_TTL; nil unless the
+// check was on at startup
+var mxCache *ttlCache[bool]
+
+// Whether the domain of addr can receive mail: it has MX records other
+// than a null MX, or failing those an A/AAAA record (the implicit MX of
+// RFC 5321). Only a definite answer counts; timeouts and resolver errors
+// fail open and aren't cached.
+func hasMailServer(ctx context.Context, cfg *Config, addr string) bool {
+	domain := emailDomain(addr)
+	if domain == "" {
+		return true
+	}
+	if mxCache != nil {
+		if ok, found := mxCache.get(domain); found {
+			return ok
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.MXTimeout)
+	defer cancel()
+	ok, err := lookupMailServer(ctx, domain)
+	if err != nil {
+		log.Printf("MX lookup for %s failed: %v", domain, err)
+		return true
+	}
+	if mxCache != nil {
+		mxCache.set(domain, ok)
+	}
+	return ok
+}
+
+func lookupMailServer(ctx context.Context, domain string) (bool, error) {
+	mxs, err := net.DefaultResolver.LookupMX(ctx, domain)
+	if err == nil && len(mxs) > 0 {
+		// A lone "." is a null MX: the domain accepts no mail
+		return !(len(mxs) == 1 && mxs[0].Host == "."), nil
+	}
+	if err != nil && !isNotFound(err) {
+		return false, err
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, domain)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return len(addrs) > 0, err
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Quality the Accept header gives a media type: from its own entry if
+// listed, else from type/* or */*. A missing header accepts everything.
+func acceptQuality(r *http.Request, mediaType string) float64 {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return 1
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	best, specificity := 0.0, -1
+	for _, part := range strings.Split(header, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		var s int
+		switch t {
+		case mediaType:
+			s = 2
+		case major + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		q := 1.0
+		if v, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			q = v
+		}
+		if s > specificity {
+			best, specificity = q, s
+		}
+	}
+	return best
+}
+
+// Whether the Accept header names the media type itself with a non-zero
+// quality. Wildcards don't count, so */* keeps the configured default.
+func accepts(r *http.Request, mediaType string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || t != mediaType {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// Plain text is only sent when the client ranks it above JSON, so */*
+// and a missing Accept header get JSON
+func prefersText(r *http.Request) bool {
+	return acceptQuality(r, "text/plain") > acceptQuality(r, "application/json")
+}
+
+// Short plain-text reply for clients preferring text/plain
+func writeText(w http.ResponseWriter, status int, format string, args ...any) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, format+"\n", args...)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Named normalization steps usable in NORMALIZE_* variables
+var normalizers = map[string]func(string) string{
+	"trim":  strings.TrimSpace,
+	"lower": strings.ToLower,
+	// Collapse runs of whitespace into single spaces
+	"collapse": func(v string) string { return strings.Join(strings.Fields(v), " ") },
+	"title":    titleCase,
+	"digits":   phoneDigits,
+}
+
+// Form fields normalization applies to, by JSON name
+func normalizedFields(f *ContactForm) map[string]*string {
+	return map[string]*string{
+		"firstName":     &f.FirstName,
+		"lastName":      &f.LastName,
+		"email":         &f.Email,
+		"phone":         &f.Phone,
+		"company":       &f.Company,
+		"budget":        &f.Budget,
+		"preferredTime": &f.PreferredTime,
+		"message":       &f.Message,
+		"utmSource":     &f.UTMSource,
+		"utmMedium":     &f.UTMMedium,
+		"utmCampaign":   &f.UTMCampaign,
+	}
+}
+
+// Parse a comma-separated list of step names
+func parseNormalizers(list string) ([]string, error) {
+	steps := splitList(list)
+	for _, s := range steps {
+		if _, ok := normalizers[s]; !ok {
+			return nil, fmt.Errorf("unknown step %q", s)
+		}
+	}
+	return steps, nil
+}
+
+// Apply the configured steps to each field in place, before validation
+func normalizeForm(form *ContactForm) {
+	steps := currentConfig().Normalize
+	for field, v := range normalizedFields(form) {
+		for _, s := range steps[field] {
+			*v = normalizers[s](*v)
+		}
+	}
+}
+
+// Upper-case the first letter of each word, leaving the rest alone so
+// names like "McDonald" survive
+func titleCase(v string) string {
+	out := []rune(v)
+	start := true
+	for i, r := range out {
+		if start && unicode.IsLetter(r) {
+			out[i] = unicode.ToTitle(r)
+		}
+		start = unicode.IsSpace(r) || r == '-' || r == '\''
+	}
+	return string(out)
+}
+
+// Keep only digits and a leading plus, so "+1 (555) 010-0000" becomes
+// "+15550100000"
+func phoneDigits(v string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(v) {
+		if r >= '0' && r <= '9' || r == '+' && i == 0 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// Read the armored or binary public key(s) notifications are encrypted to
+func loadPGPKeys(path string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no public keys", path)
+	}
+	return keys, nil
+}
+
+// Wrap a MIME entity in a PGP/MIME (RFC 3156) multipart/encrypted
+// message. The inner Content-Type header is encrypted along with the
+// body so the recipient's client can rebuild the original structure.
+func pgpEncrypt(keys openpgp.EntityList, ctype, cte string, body []byte) (string, []byte, error) {
+	var armored bytes.Buffer
+	aw, err := armor.Encode(&armored, "PGP MESSAGE", nil)
+	if err != nil {
+		return "", nil, err
+	}
+	pw, err := openpgp.Encrypt(aw, keys, nil, nil, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	pw.Write([]byte("Content-Type: " + ctype + "\r\n"))
+	if cte != "" {
+		pw.Write([]byte("Content-Transfer-Encoding: " + cte + "\r\n"))
+	}
+	pw.Write([]byte("\r\n"))
+	pw.Write(body)
+	if err := pw.Close(); err != nil {
+		return "", nil, err
+	}
+	if err := aw.Close(); err != nil {
+		return "", nil, err
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	part, _ := w.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/pgp-encrypted"}})
+	part.Write([]byte("Version: 1\r\n"))
+	part, _ = w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":        {`application/octet-stream; name="encrypted.asc"`},
+		"Content-Disposition": {`inline; filename="encrypted.asc"`},
+	})
+	part.Write(armored.Bytes())
+	part.Write([]byte("\r\n"))
+	w.Close()
+	return fmt.Sprintf(`multipart/encrypted; protocol="application/pgp-encrypted"; boundary=%s`, w.Boundary()), buf.Bytes(), nil
+}
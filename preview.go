@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Render the notification for a sample submission without sending or
+// storing it (POST /api/preview, admin only). The form is normalized as
+// usual; validation problems are reported but don't stop the render, and
+// PGP encryption is skipped so the content stays readable. With
+// ?format=raw the serialized message is returned as text/plain.
+func previewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var form ContactForm
+	if status, msg := decodeJSONBody(w, r, &form, currentConfig().MaxBodyBytes); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	normalizeForm(&form)
+	errs := validate(form)
+	applyFieldDefaults(&form, currentConfig().FieldDefaults)
+	form.Locale = resolveLocale(currentConfig(), form.Locale, r)
+
+	sub := newSubmission(form)
+	e := newNotification(sub)
+	encrypted := e.EncryptTo != nil
+	e.EncryptTo = nil
+	raw, err := e.bytes()
+	if err != nil {
+		log.Println("Preview render error:", err)
+		http.Error(w, "Failed to compose message", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "raw" {
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		w.Write(raw)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"referenceId": sub.ID,
+		"from":        e.From,
+		"to":          e.To,
+		"subject":     e.Subject,
+		"text":        e.Body,
+		"html":        e.HTML,
+		"encrypted":   encrypted,
+		"errors":      errs,
+		"raw":         string(raw),
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// How contactHandler reports errors by default
+const (
+	errorFormatJSON    = "json"
+	errorFormatProblem = "problem"
+	// Deprecated: the bare message, the default before JSON; still served
+	// as JSON to clients asking for it via Accept
+	errorFormatText = "text"
+)
+
+const problemContentType = "application/problem+json"
+
+// RFC 7807 Problem Details body. Extension members: Errors lists every
+// failed field for validation problems; Code and MinScore tell the
+// frontend to re-run reCAPTCHA for a captcha step-up.
+type problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	Code     string       `json:"code,omitempty"`
+	MinScore float64      `json:"minScore,omitempty"`
+}
+
+// Reply with an error. A client asking for application/problem+json gets
+// Problem Details and one preferring text/plain the bare message;
+// otherwise ERROR_FORMAT picks between Problem Details, the simple
+// {"status":"error"} JSON and, deprecated, the bare message.
+func writeError(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	writeProblem(w, r, problem{Status: status, Detail: detail})
+}
+
+// Like writeError for a failed validation, carrying all field errors in
+// the body; the plain-text reply names only the first
+func writeValidationError(w http.ResponseWriter, r *http.Request, errs []FieldError) {
+	writeProblem(w, r, problem{Status: http.StatusBadRequest, Detail: errs[0].Error(), Errors: errs})
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p problem) {
+	asProblem := accepts(r, problemContentType)
+	format := currentConfig().ErrorFormat
+	if !asProblem && (prefersText(r) || format == errorFormatText && !accepts(r, "application/json")) {
+		http.Error(w, p.Detail, p.Status)
+		return
+	}
+	id := requestID(r)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Request-ID", id)
+	if !asProblem && format != errorFormatProblem {
+		resp := map[string]any{"status": "error", "error": p.Detail}
+		if len(p.Errors) > 0 {
+			resp["errors"] = p.Errors
+		}
+		if p.Code != "" {
+			resp["code"] = p.Code
+			resp["minScore"] = p.MinScore
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(p.Status)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = "urn:request:" + id
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// The caller's X-Request-ID when it sent one, else the trace ID of the
+// request span, else a fresh reference
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" && len(id) <= 128 && noControlChars(id) == "" {
+		return id
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return newReferenceID()
+}
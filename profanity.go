@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"unicode"
+)
+
+// What happens to submissions containing listed words (PROFANITY_ACTION)
+const (
+	profanityReject = "reject"
+	profanityDrop   = "drop"
+	profanityFlag   = "flag"
+)
+
+// Marker recorded on flagged submissions and shown in the notification
+const flagProfanity = "profanity"
+
+// Read PROFANITY_WORDS_FILE: one word per line, # comments
+func loadWordList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var words []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line != "" {
+			words = append(words, line)
+		}
+	}
+	return words, nil
+}
+
+func wordSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[strings.ToLower(w)] = true
+	}
+	return set
+}
+
+// Fields the filter looks at, by JSON name
+func profanityFields(f *ContactForm) map[string]string {
+	return map[string]string{
+		"firstName": f.FirstName,
+		"lastName":  f.LastName,
+		"message":   f.Message,
+	}
+}
+
+// Name of the first checked field containing a listed word, or "".
+// Matching is on whole words, ignoring case, so "Scunthorpe" doesn't
+// trip on its substrings.
+func profaneField(cfg *Config, form *ContactForm) string {
+	if len(cfg.ProfanityWords) == 0 {
+		return ""
+	}
+	for _, rule := range formRules {
+		v, ok := profanityFields(form)[rule.field]
+		if !ok {
+			continue
+		}
+		words := strings.FieldsFunc(strings.ToLower(v), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		for _, w := range words {
+			if cfg.ProfanityWords[w] {
+				return rule.field
+			}
+		}
+	}
+	return ""
+}
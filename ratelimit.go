@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Fixed-window counter per key (client IP, submitter email)
+type rateLimiter struct {
+	mu     sync.Mutex
+	window time.Duration
+	hits   map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// Outcome of a rate-limit check
+type rateResult struct {
+	allowed   bool
+	limit     int
+	remaining int
+	// Hits in the current window, this one included
+	count int
+	reset time.Time
+}
+
+// Set up in main when RATE_LIMIT is positive
+var limiter *rateLimiter
+
+// Bucket for /api/verify-captcha, set up in main regardless of RATE_LIMIT
+// so VERIFY_CAPTCHA_RATE_LIMIT applies and can be reloaded on its own
+var verifyLimiter *rateLimiter
+
+func newRateLimiter(window time.Duration) *rateLimiter {
+	l := &rateLimiter{window: window, hits: make(map[string]*rateWindow)}
+	registerSweeper(l)
+	return l
+}
+
+// Count a hit against key and report whether it is within limit. A
+// limit of 0 or less, e.g. after /reload set RATE_LIMIT=0, lets every
+// hit through uncounted.
+func (l *rateLimiter) allow(key string, limit int) rateResult {
+	if limit <= 0 {
+		return rateResult{allowed: true}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.hits[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &rateWindow{start: now}
+		l.hits[key] = w
+	}
+	w.count++
+
+	res := rateResult{
+		allowed: w.count <= limit,
+		limit:   limit,
+		count:   w.count,
+		reset:   w.start.Add(l.window),
+	}
+	if res.allowed {
+		res.remaining = limit - w.count
+	}
+	return res
+}
+
+// Report key's current state against limit without counting a hit
+func (l *rateLimiter) peek(key string, limit int) rateResult {
+	if limit <= 0 {
+		return rateResult{allowed: true}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	res := rateResult{limit: limit, remaining: limit, allowed: true}
+	if w, ok := l.hits[key]; ok && time.Since(w.start) < l.window {
+		res.remaining = max(limit-w.count, 0)
+		res.allowed = res.remaining > 0
+		res.reset = w.start.Add(l.window)
+	}
+	return res
+}
+
+// X-RateLimit-* headers so the frontend can hold back before a 429.
+// Reset is a Unix timestamp and is left out until a window has started;
+// all of them are left out when there is no limit.
+func setRateLimitHeaders(w http.ResponseWriter, res rateResult) {
+	h := w.Header()
+	if res.limit <= 0 {
+		h.Del("X-RateLimit-Limit")
+		h.Del("X-RateLimit-Remaining")
+		h.Del("X-RateLimit-Reset")
+		return
+	}
+	h.Set("X-RateLimit-Limit", strconv.Itoa(res.limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(res.remaining))
+	if res.reset.IsZero() {
+		h.Del("X-RateLimit-Reset")
+	} else {
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(res.reset.Unix(), 10))
+	}
+}
+
+func (l *rateLimiter) sweep(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, w := range l.hits {
+		if now.Sub(w.start) >= l.window {
+			delete(l.hits, key)
+		}
+	}
+}
+
+// Borderline captcha scores get the stricter limit; clear humans get
+// the normal one
+func submissionLimit(score float64) int {
+	cfg := currentConfig()
+	if score <= cfg.RateLimitStrictScore {
+		return cfg.RateLimitStrict
+	}
+	return cfg.RateLimit
+}
+
+// With CAPTCHA_STEP_UP the rate limit is soft: past it a submission still
+// goes through if its score is above CAPTCHA_STEP_UP_SCORE, up to
+// RATE_LIMIT_HARD hits per window (three times RATE_LIMIT by default,
+// 0 = no ceiling)
+func stepUpAllowed(cfg *Config, res rateResult, score float64) bool {
+	return cfg.CaptchaStepUp && score > cfg.CaptchaStepUpScore && (cfg.RateLimitHard == 0 || res.count <= cfg.RateLimitHard)
+}
+
+// Whether a submission over the soft limit may still try again with a
+// fresh, higher-scoring captcha
+func stepUpAvailable(cfg *Config, res rateResult) bool {
+	return cfg.CaptchaStepUp && (cfg.RateLimitHard == 0 || res.count < cfg.RateLimitHard)
+}
+
+// 429 asking the frontend to re-challenge and resubmit with a fresh token
+func writeStepUp(w http.ResponseWriter, r *http.Request, minScore float64) {
+	w.Header().Set("X-Captcha-Step-Up", strconv.FormatFloat(minScore, 'g', -1, 64))
+	writeProblem(w, r, problem{
+		Status:   http.StatusTooManyRequests,
+		Detail:   "Too many submissions, please complete the captcha again",
+		Code:     "captcha_step_up",
+		MinScore: minScore,
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitReload(t *testing.T) {
+	srv, _ := setupTestServer(t, 0.9)
+	configFile := filepath.Join(t.TempDir(), "contact.env")
+	t.Setenv("CONFIG_FILE", configFile)
+	prevLimiter := limiter
+	limiter = newRateLimiter(time.Hour)
+	t.Cleanup(func() { limiter = prevLimiter })
+
+	token := 0
+	post := func() *http.Response {
+		token++
+		return postContact(t, srv, strings.Replace(validSubmission, "token-1", fmt.Sprintf("token-%d", token), 1))
+	}
+	reload := func(rateLimit string) []string {
+		if err := os.WriteFile(configFile, []byte("RATE_LIMIT="+rateLimit+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		reloadHandler(w, httptest.NewRequest(http.MethodPost, "/reload", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("reload status = %d, body %q", w.Code, w.Body)
+		}
+		var got struct {
+			RestartRequired []string `json:"restartRequired"`
+		}
+		json.NewDecoder(w.Body).Decode(&got)
+		return got.RestartRequired
+	}
+
+	reload("2")
+	for range 2 {
+		if resp := post(); resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d within the limit", resp.StatusCode)
+		}
+	}
+	if resp := post(); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status = %d over the limit, want 429", resp.StatusCode)
+	}
+
+	if restart := reload("0"); len(restart) != 0 {
+		t.Errorf("restartRequired = %v turning the limit off", restart)
+	}
+	for range 3 {
+		resp := post()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d with the limit turned off", resp.StatusCode)
+		}
+		if h := resp.Header.Get("X-RateLimit-Limit"); h != "" {
+			t.Errorf("X-RateLimit-Limit = %q with the limit turned off", h)
+		}
+	}
+
+	if restart := reload("10"); len(restart) != 0 {
+		t.Errorf("restartRequired = %v raising the limit", restart)
+	}
+	if resp := post(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d after raising the limit", resp.StatusCode)
+	}
+
+	// Started without a limiter, turning the limit on needs a restart
+	limiter = nil
+	reload("0")
+	if restart := reload("5"); !reflect.DeepEqual(restart, []string{"RATE_LIMIT"}) {
+		t.Errorf("restartRequired = %v, want [RATE_LIMIT]", restart)
+	}
+}
+
+func TestVerifyCaptchaRateLimit(t *testing.T) {
+	t.Setenv("VERIFY_CAPTCHA_RATE_LIMIT", "2")
+	setupTestServer(t, 0.9)
+	prevLimiter, prevVerify := limiter, verifyLimiter
+	limiter, verifyLimiter = nil, newRateLimiter(time.Hour)
+	t.Cleanup(func() { limiter, verifyLimiter = prevLimiter, prevVerify })
+
+	for i := range 3 {
+		body := fmt.Sprintf(`{"recaptchaToken": "verify-%d"}`, i)
+		w := httptest.NewRecorder()
+		verifyCaptchaHandler(w, httptest.NewRequest(http.MethodPost, "/api/verify-captcha", strings.NewReader(body)))
+		want := http.StatusOK
+		if i == 2 {
+			want = http.StatusTooManyRequests
+		}
+		if w.Code != want {
+			t.Fatalf("call %d: status = %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const defaultRecaptchaVerifyURL = "https://www.google.com/recaptcha/api/siteverify"
+
+// Hashes of tokens already presented, set up in main
+var seenTokens *ttlCache[struct{}]
+
+// Client for siteverify and Enterprise assessments; main applies
+// RECAPTCHA_TIMEOUT
+var recaptchaClient = &http.Client{Timeout: 10 * time.Second}
+
+// Claim the token and report whether it was already used within the
+// replay window. Only a hash is kept so tokens never sit in memory.
+func isReplayedToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	return !seenTokens.add(tokenHash(token), struct{}{})
+}
+
+// Give back a token claimed by isReplayedToken, for a submission that
+// wasn't accepted after all
+func releaseToken(token string) {
+	if token != "" {
+		seenTokens.delete(tokenHash(token))
+	}
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Recaptcha verification response
+type RecaptchaResponse struct {
+	Success bool    `json:"success"`
+	Score   float64 `json:"score"`
+	Action  string  `json:"action"`
+	// When the challenge was solved, e.g. "2024-05-01T10:00:00Z"
+	ChallengeTS string   `json:"challenge_ts"`
+	ErrorCodes  []string `json:"error-codes"`
+}
+
+var (
+	errCaptchaFailed  = errors.New("reCAPTCHA failed")
+	errCaptchaExpired = errors.New("reCAPTCHA expired")
+	errCaptchaBusy    = errors.New("too many pending reCAPTCHA verifications")
+)
+
+// Slots for concurrent siteverify calls with RECAPTCHA_MAX_CONCURRENT;
+// nil means unbounded
+var (
+	captchaSlots   chan struct{}
+	captchaWaiting atomic.Int64
+)
+
+// Take a siteverify slot, waiting up to RECAPTCHA_QUEUE_TIMEOUT behind at
+// most RECAPTCHA_MAX_WAITING other requests, otherwise errCaptchaBusy
+func acquireCaptchaSlot(ctx context.Context, cfg *Config) (release func(), err error) {
+	if captchaSlots == nil {
+		return func() {}, nil
+	}
+	release = func() { <-captchaSlots }
+	select {
+	case captchaSlots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	waiting := captchaWaiting.Add(1)
+	defer captchaWaiting.Add(-1)
+	if cfg.RecaptchaMaxWaiting > 0 && waiting > int64(cfg.RecaptchaMaxWaiting) {
+		return nil, errCaptchaBusy
+	}
+	timer := time.NewTimer(cfg.RecaptchaQueueTimeout)
+	defer timer.Stop()
+	select {
+	case captchaSlots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, errCaptchaBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Whether the token was solved too long ago to be accepted. Google
+// reports its own expiry as timeout-or-duplicate; duplicates we issued
+// are caught earlier by the replay check.
+func (r *RecaptchaResponse) expired(maxAge time.Duration) bool {
+	if slices.Contains(r.ErrorCodes, "timeout-or-duplicate") {
+		return true
+	}
+	if maxAge <= 0 || r.ChallengeTS == "" {
+		return false
+	}
+	ts, err := time.Parse(time.RFC3339, r.ChallengeTS)
+	return err == nil && time.Since(ts) > maxAge
+}
+
+// Validate reCAPTCHA v3 token, returning the score. The error is
+// errCaptchaExpired for stale tokens the frontend should refresh and
+// errCaptchaFailed for any other rejection, including scores at or
+// below RECAPTCHA_MIN_SCORE and, when action is set, tokens minted for
+// a different action.
+func verifyRecaptcha(ctx context.Context, token, action string) (score float64, err error) {
+	_, span := tracer.Start(ctx, "recaptcha.verify")
+	defer func() {
+		span.SetAttributes(attribute.Float64("recaptcha.score", score), attribute.Bool("recaptcha.passed", err == nil))
+		span.End()
+	}()
+
+	cfg := currentConfig()
+	if err := requireSet(recaptchaCredentials(cfg)); err != nil {
+		log.Println("reCAPTCHA not configured:", err)
+		return 0, errCaptchaFailed
+	}
+
+	release, err := acquireCaptchaSlot(ctx, cfg)
+	if err != nil {
+		log.Println("reCAPTCHA verification not attempted:", err)
+		return 0, errCaptchaBusy
+	}
+	defer release()
+
+	var result *RecaptchaResponse
+	if cfg.RecaptchaMode == recaptchaModeEnterprise {
+		result, err = createAssessment(ctx, cfg, token, action)
+	} else {
+		result, err = siteverify(ctx, cfg, token)
+	}
+	if err != nil {
+		log.Println("reCAPTCHA", err)
+		return 0, errCaptchaFailed
+	}
+
+	debugf("reCAPTCHA score: %v", result.Score)
+	if result.Success {
+		captchaScores.observe(result.Score)
+	}
+	if result.expired(cfg.RecaptchaMaxTokenAge) {
+		debugf("reCAPTCHA token expired (solved %s)", result.ChallengeTS)
+		return result.Score, errCaptchaExpired
+	}
+	if !result.Success || result.Score <= cfg.RecaptchaMinScore {
+		return result.Score, errCaptchaFailed
+	}
+	if action != "" && result.Action != action {
+		log.Printf("reCAPTCHA action %q does not match expected %q", result.Action, action)
+		return result.Score, errCaptchaFailed
+	}
+	return result.Score, nil
+}
+
+// Ask the classic siteverify endpoint about token
+func siteverify(ctx context.Context, cfg *Config, token string) (*RecaptchaResponse, error) {
+	form := url.Values{
+		"secret":   {cfg.RecaptchaSecret},
+		"response": {token},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.RecaptchaVerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("request error: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := recaptchaClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	var result RecaptchaResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parse error: %w", err)
+	}
+	return &result, nil
+}
+
+// Check a token on its own (POST /api/verify-captcha) so multi-step forms
+// can fail fast before the visitor fills in the rest. Tokens are single
+// use, so the final submission needs a fresh one. Hits are rate limited
+// in a bucket of their own, VERIFY_CAPTCHA_RATE_LIMIT per client IP, even
+// when submissions aren't.
+func verifyCaptchaHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := currentConfig()
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST, OPTIONS")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := clientIP(r)
+	if verifyLimiter != nil {
+		res := verifyLimiter.allow(ip.String(), cfg.VerifyCaptchaRateLimit)
+		setRateLimitHeaders(w, res)
+		if !res.allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(res.reset).Seconds())+1))
+			http.Error(w, "Too many requests, please try again later", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	var req struct {
+		Token    string `json:"recaptchaToken"`
+		FormType string `json:"formType"`
+	}
+	if status, msg := decodeJSONBody(w, r, &req, cfg.MaxBodyBytes); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	if req.Token == "" {
+		http.Error(w, "recaptchaToken is required", http.StatusBadRequest)
+		return
+	}
+
+	score, valid := 1.0, true
+	if prefixesContain(cfg.CaptchaBypass, ip) {
+		debugf("reCAPTCHA pre-check bypassed for %s (CAPTCHA_BYPASS_IPS)", ip)
+	} else if isReplayedToken(req.Token) {
+		score, valid = 0, false
+	} else {
+		origin := r.Header.Get("Origin")
+		if !slices.Contains(cfg.AllowedOrigins, origin) {
+			origin = ""
+		}
+		var err error
+		score, err = verifyRecaptcha(r.Context(), req.Token, cfg.route(req.FormType, origin).RecaptchaAction)
+		if errors.Is(err, errCaptchaBusy) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Captcha verification is busy, please retry shortly", http.StatusServiceUnavailable)
+			return
+		}
+		valid = err == nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"valid": valid, "score": score})
+}
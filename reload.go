@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Re-read CONFIG_FILE and the environment and swap the active config.
+// On any error the current config stays in place. Settings consumed once
+// at startup (storage, rate-limit window, integrations) still need a
+// restart and are listed as restartRequired; per-request settings such
+// as recipients, thresholds, origins and SMTP credentials take effect
+// immediately.
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	next, err := loadConfig()
+	if err != nil {
+		log.Println("Config reload rejected:", err)
+		http.Error(w, "Invalid configuration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	prev := activeConfig.Swap(next)
+	changed := changedKeys(prev.values, next.values)
+	restart := []string{}
+	for _, key := range changed {
+		if needsRestart(key, next) {
+			log.Printf("Config reload: %s changed to %s, takes effect after a restart", key, displayValue(key, next.values[key]))
+			restart = append(restart, key)
+			continue
+		}
+		log.Printf("Config reload: %s changed to %s", key, displayValue(key, next.values[key]))
+	}
+	log.Printf("Config reloaded, %d value(s) changed", len(changed))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"status": "reloaded", "changed": changed, "restartRequired": restart})
+}
+
+// Variables consumed once in main, whose new value a reload can't apply
+var startupKeys = map[string]bool{
+	"RATE_LIMIT_WINDOW":        true,
+	"IDEMPOTENCY_WINDOW":       true,
+	"RECAPTCHA_REPLAY_WINDOW":  true,
+	"RECAPTCHA_TIMEOUT":        true,
+	"RECAPTCHA_MAX_CONCURRENT": true,
+	"AUDIT_LOG_FILE":           true,
+	"SMTP_POOL_SIZE":           true,
+	"ASYNC_SEND":               true,
+	"SEND_QUEUE_SIZE":          true,
+	"MERGE_WINDOW":             true,
+	"SUBMISSIONS_DIR":          true,
+	"EMAIL_TEMPLATE_DIR":       true,
+}
+
+// Whether a changed key only applies after a restart. RATE_LIMIT can be
+// lowered, raised or turned off at runtime, but turning it on needs the
+// limiter that main only sets up when it starts with a positive limit.
+func needsRestart(key string, next *Config) bool {
+	if key == "RATE_LIMIT" {
+		return limiter == nil && next.RateLimit > 0
+	}
+	return startupKeys[key]
+}
+
+func changedKeys(prev, next map[string]string) []string {
+	changed := []string{}
+	for key, v := range next {
+		if old, ok := prev[key]; !ok || old != v {
+			changed = append(changed, key)
+		}
+	}
+	for key := range prev {
+		if _, ok := next[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Whether a variable holds a credential that must never be logged
+func isSecretKey(key string) bool {
+	for _, marker := range []string{"PASSWORD", "SECRET", "TOKEN", "API_KEY", "PRIVATE", "REDACT_KEY"} {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func displayValue(key, v string) string {
+	if v == "" {
+		return "(unset)"
+	}
+	if isSecretKey(key) {
+		return "***"
+	}
+	return v
+}
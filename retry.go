@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// Every RETRY_INTERVAL until ctx is cancelled, send what maintenance
+// mode held back and resend failed submissions. Nothing is sent while
+// maintenance mode is on.
+func runRetryWorker(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if currentConfig().MaintenanceMode {
+				continue
+			}
+			sendDeferredSubmissions()
+			sendCappedSubmissions(now)
+			retryFailedSubmissions(now)
+		}
+	}
+}
+
+// Delay before the next resend of a submission that has already been
+// retried n times: RETRY_BACKOFF, doubling after each attempt
+func retryDelay(n int) time.Duration {
+	d := currentConfig().RetryBackoff
+	for range n {
+		d *= 2
+	}
+	return d
+}
+
+// Send submissions stored while maintenance mode was on
+func sendDeferredSubmissions() {
+	deferred, err := store.List(statusDeferred)
+	if err != nil {
+		log.Println("Retry worker: listing deferred submissions:", err)
+		return
+	}
+	for _, sub := range deferred {
+		err := deliverSubmission(context.Background(), sub, nil)
+		if errors.Is(err, errDailyCapReached) || errors.Is(err, errMaintenanceMode) {
+			return
+		}
+		if err == nil {
+			log.Printf("Deferred submission %s sent", sub.ID)
+			if currentConfig().AutoReply && !sub.Batch {
+				sendAutoReply(sub)
+			}
+		}
+	}
+}
+
+// Send submissions stored without email by DAILY_SEND_CAP, once the
+// day has rolled over and the cap allows it again
+func sendCappedSubmissions(now time.Time) {
+	if dailySends.reached(currentConfig().DailySendCap, now) {
+		return
+	}
+	capped, err := store.List(statusCapped)
+	if err != nil {
+		log.Println("Retry worker: listing capped submissions:", err)
+		return
+	}
+	for _, sub := range capped {
+		err := deliverSubmission(context.Background(), sub, nil)
+		if errors.Is(err, errDailyCapReached) || errors.Is(err, errMaintenanceMode) {
+			return
+		}
+		if err == nil {
+			log.Printf("Capped submission %s sent", sub.ID)
+			if currentConfig().AutoReply && !sub.Batch {
+				sendAutoReply(sub)
+			}
+		}
+	}
+}
+
+// Resend every failed submission that is due, giving up (and leaving it
+// failed for a manual resend) after RETRY_MAX_ATTEMPTS tries
+func retryFailedSubmissions(now time.Time) {
+	cfg := currentConfig()
+	if cfg.RetryMaxAttempts == 0 {
+		return
+	}
+	failed, err := store.List(statusFailed)
+	if err != nil {
+		log.Println("Retry worker: listing failed submissions:", err)
+		return
+	}
+	for _, sub := range failed {
+		if sub.Retries >= cfg.RetryMaxAttempts || now.Before(sub.UpdatedAt.Add(retryDelay(sub.Retries))) {
+			continue
+		}
+		sub.Retries++
+		err := deliverSubmission(context.Background(), sub, nil)
+		if errors.Is(err, errDailyCapReached) || errors.Is(err, errMaintenanceMode) {
+			return
+		}
+		if err != nil {
+			if sub.Retries >= cfg.RetryMaxAttempts {
+				log.Printf("Submission %s still failing after %d retries, giving up: %v", sub.ID, sub.Retries, err)
+			} else {
+				log.Printf("Submission %s retry %d failed: %v", sub.ID, sub.Retries, err)
+			}
+			continue
+		}
+		log.Printf("Submission %s sent on retry %d", sub.ID, sub.Retries)
+		// The visitor got a 202 and is still waiting for their reference
+		if cfg.AutoReply && !sub.Batch {
+			sendAutoReply(sub)
+		}
+	}
+}
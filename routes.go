@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// FormRoute says where submissions of one form type are delivered.
+// Recipient may list several comma-separated addresses; the first is the
+// primary and must accept the message for the send to succeed. From is
+// an optional alias shown as the sender; SMTP still authenticates as
+// SMTP_EMAIL.
+type FormRoute struct {
+	Recipient string `json:"recipient"`
+	Subject   string `json:"subject"`
+	From      string `json:"from"`
+	// Optional confirmation sent to the submitter instead of the generic
+	// localized one; both are templates over mailData
+	AutoReply        string `json:"autoReply"`
+	AutoReplySubject string `json:"autoReplySubject"`
+	// reCAPTCHA action the form's tokens must carry, e.g. "sales_submit",
+	// so a token minted for one form can't be spent on another; not
+	// checked when empty
+	RecaptchaAction string `json:"recaptchaAction"`
+
+	recipients       []string
+	subject          *template.Template
+	autoReply        *template.Template
+	autoReplySubject *template.Template
+}
+
+// Data available to subject and body templates
+type mailData struct {
+	ContactForm
+	Ref string
+}
+
+const defaultSubject = "New Contact Form Submission [{{.Ref}}]"
+
+func (fr *FormRoute) compile(name string, fromDomains []string) error {
+	fr.recipients = splitList(fr.Recipient)
+	if len(fr.recipients) == 0 {
+		return fmt.Errorf("%s: recipient list is empty", name)
+	}
+	for _, addr := range fr.recipients {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("%s: recipient %q: %w", name, addr, err)
+		}
+	}
+	if fr.From != "" {
+		if err := checkFromAlias(fr.From, fromDomains); err != nil {
+			return fmt.Errorf("%s: from: %w", name, err)
+		}
+	}
+	if fr.Subject == "" {
+		fr.Subject = defaultSubject
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(fr.Subject)
+	if err != nil {
+		return fmt.Errorf("%s: subject: %w", name, err)
+	}
+	fr.subject = t
+
+	if fr.AutoReply == "" {
+		if fr.AutoReplySubject != "" {
+			return fmt.Errorf("%s: autoReplySubject requires autoReply", name)
+		}
+		return nil
+	}
+	if fr.AutoReplySubject == "" {
+		fr.AutoReplySubject = defaultAutoReplySubject
+	}
+	if fr.autoReply, err = template.New(name + " auto-reply").Option("missingkey=error").Parse(fr.AutoReply); err != nil {
+		return fmt.Errorf("%s: autoReply: %w", name, err)
+	}
+	if fr.autoReplySubject, err = template.New(name + " auto-reply subject").Option("missingkey=error").Parse(fr.AutoReplySubject); err != nil {
+		return fmt.Errorf("%s: autoReplySubject: %w", name, err)
+	}
+	// Unlike subjects these are only used after the submission succeeded,
+	// so catch bad field references now rather than on the first reply
+	if _, _, err := fr.renderAutoReply(sampleMailData()); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+const defaultAutoReplySubject = "We received your message [{{.Ref}}]"
+
+// Subject and body of the route's own auto-reply; only call when
+// fr.autoReply is set
+func (fr *FormRoute) renderAutoReply(data mailData) (subject, body string, err error) {
+	var s, b strings.Builder
+	if err := fr.autoReplySubject.Execute(&s, data); err != nil {
+		return "", "", fmt.Errorf("autoReplySubject: %w", err)
+	}
+	if err := fr.autoReply.Execute(&b, data); err != nil {
+		return "", "", fmt.Errorf("autoReply: %w", err)
+	}
+	return sanitizeHeader(s.String()), b.String(), nil
+}
+
+// Render the subject with form values. The result goes straight into a
+// header, so line breaks and other control characters are removed to
+// keep fields like Company from injecting headers.
+func (fr *FormRoute) renderSubject(data mailData) (string, error) {
+	var b strings.Builder
+	if err := fr.subject.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return sanitizeHeader(b.String()), nil
+}
+
+// Replace CR, LF and other control characters with spaces, collapsing
+// the result onto one trimmed line
+func sanitizeHeader(v string) string {
+	v = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, v)
+	return strings.Join(strings.Fields(v), " ")
+}
+
+// Parse FORM_TYPES, a JSON object of form type to route, e.g.
+// {"support": {"recipient": "support@next-kiosk.com", "subject": "Support: {{.Company}} [{{.Ref}}]"}}.
+// Routes without a subject use the default one. ORIGIN_ROUTES has the
+// same shape keyed by origin, e.g. "https://brand-b.com".
+func parseFormRoutes(raw string, fromDomains []string) (map[string]*FormRoute, error) {
+	routes := map[string]*FormRoute{}
+	if raw == "" {
+		return routes, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &routes); err != nil {
+		return nil, err
+	}
+	for name, fr := range routes {
+		if err := fr.compile(name, fromDomains); err != nil {
+			return nil, err
+		}
+	}
+	return routes, nil
+}
+
+// An alias is only usable if our SMTP account may send for its domain
+func checkFromAlias(from string, allowed []string) error {
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return err
+	}
+	if addr.Address != from {
+		return fmt.Errorf("%q must be a bare address", from)
+	}
+	domain := emailDomain(from)
+	for _, d := range allowed {
+		if strings.EqualFold(domain, d) {
+			return nil
+		}
+	}
+	return fmt.Errorf("domain of %q is not in SMTP_ALLOWED_FROM_DOMAINS", from)
+}
+
+func emailDomain(addr string) string {
+	return strings.ToLower(addr[strings.LastIndexByte(addr, '@')+1:])
+}
+
+// Route for a submission. A known form type wins; otherwise the site it
+// was posted from (ORIGIN_ROUTES) replaces the default route.
+func (c *Config) route(formType, origin string) *FormRoute {
+	if fr, ok := c.FormTypes[formType]; ok {
+		return fr
+	}
+	if fr, ok := c.OriginRoutes[origin]; ok {
+		return fr
+	}
+	return c.DefaultRoute
+}
+
+// Split a comma-separated list, dropping blanks
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
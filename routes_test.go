@@ -0,0 +1,88 @@
+package main
+
+import (
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestSubjectTemplateCannotInjectHeaders(t *testing.T) {
+	prev := activeConfig.Swap(&Config{SMTPEmail: "noreply@next-kiosk.com"})
+	t.Cleanup(func() { activeConfig.Store(prev) })
+
+	route := &FormRoute{Recipient: "sales@next-kiosk.com", Subject: "Lead: {{.Company}} [{{.Ref}}]"}
+	if err := route.compile("sales", nil); err != nil {
+		t.Fatal(err)
+	}
+	data := mailData{
+		ContactForm: ContactForm{Company: "Acme\r\nBcc: victim@example.com\r\nX-Injected:\tyes\x00"},
+		Ref:         "ABCD2345",
+	}
+	subject, err := route.renderSubject(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsAny(subject, "\r\n\t\x00") {
+		t.Fatalf("rendered subject still contains control characters: %q", subject)
+	}
+
+	e := &Email{To: []string{"sales@next-kiosk.com"}, Subject: subject, Body: "hello"}
+	raw, err := e.bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("message is not well-formed: %v", err)
+	}
+	for _, h := range []string{"Bcc", "X-Injected"} {
+		if v, ok := msg.Header[h]; ok {
+			t.Errorf("injected header %s: %q", h, v)
+		}
+	}
+	want := "Lead: Acme Bcc: victim@example.com X-Injected: yes [ABCD2345]"
+	if got := msg.Header.Get("Subject"); got != want {
+		t.Errorf("Subject = %q, want %q", got, want)
+	}
+}
+
+func TestNonASCIISubjectIsEncoded(t *testing.T) {
+	prev := activeConfig.Swap(&Config{SMTPEmail: "noreply@next-kiosk.com"})
+	t.Cleanup(func() { activeConfig.Store(prev) })
+
+	route := &FormRoute{Recipient: "sales@next-kiosk.com", Subject: "Lead: {{.Company}} [{{.Ref}}]"}
+	if err := route.compile("sales", nil); err != nil {
+		t.Fatal(err)
+	}
+	subject, err := route.renderSubject(mailData{
+		ContactForm: ContactForm{Company: "Güneş Yazılım Ltd. Şti."},
+		Ref:         "ABCD2345",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Email{To: []string{"sales@next-kiosk.com"}, Subject: subject, Body: "hello"}
+	raw, err := e.bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("message is not well-formed: %v", err)
+	}
+	header := msg.Header.Get("Subject")
+	for _, r := range header {
+		if r > 0x7f {
+			t.Fatalf("Subject header is not ASCII: %q", header)
+		}
+	}
+	got, err := new(mime.WordDecoder).DecodeHeader(header)
+	if err != nil {
+		t.Fatalf("Subject %q does not decode: %v", header, err)
+	}
+	if want := "Lead: Güneş Yazılım Ltd. Şti. [ABCD2345]"; got != want {
+		t.Errorf("decoded Subject = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Submissions waiting to be emailed, nil unless ASYNC_SEND is set
+var sendQueue chan *Submission
+
+// Hand sub to the send worker; false when the queue is full
+func enqueueSend(sub *Submission) bool {
+	select {
+	case sendQueue <- sub:
+		return true
+	default:
+		return false
+	}
+}
+
+// Email queued submissions until ctx is cancelled; whatever is still
+// queued then is left for drainSendQueue
+func runSendWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sub := <-sendQueue:
+			if err := deliverSubmission(context.Background(), sub, nil); err == nil && currentConfig().AutoReply {
+				go sendAutoReply(sub)
+			}
+		}
+	}
+}
+
+var errShutdownUnsent = errors.New("not sent before shutdown")
+
+// Send what is left in the queue at shutdown until ctx expires, then
+// mark the rest failed in SUBMISSIONS_DIR so they can be resent after
+// restart, by the retry worker or by hand
+func drainSendQueue(ctx context.Context) {
+	var flushed, persisted int
+	for {
+		var sub *Submission
+		select {
+		case sub = <-sendQueue:
+		default:
+			log.Printf("Send queue drained: %d sent, %d stored as failed", flushed, persisted)
+			return
+		}
+		if ctx.Err() != nil {
+			recordSubmission(sub, statusFailed, errShutdownUnsent)
+			persisted++
+			continue
+		}
+		if err := deliverSubmission(ctx, sub, nil); err != nil {
+			// deliverSubmission has already stored it as failed or capped
+			persisted++
+			continue
+		}
+		flushed++
+		if currentConfig().AutoReply {
+			sendAutoReply(sub)
+		}
+	}
+}
+
+// 202 response for a queued submission, pointing at its status endpoint
+func writeAccepted(w http.ResponseWriter, r *http.Request, sub *Submission) {
+	w.Header().Set("Location", "/api/contact/status/"+sub.ID)
+	if prefersText(r) {
+		writeText(w, http.StatusAccepted, "Message accepted for sending. Reference: %s", sub.ID)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(successBody("accepted", sub.ID, &sub.Form, ""))
+}
+
+// Delivery state of a submission (GET /api/contact/status/{id}), for the
+// frontend to poll after a 202. Only the state is returned, never the
+// form contents.
+func submissionStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sub, err := store.Get(r.PathValue("id"))
+	if errors.Is(err, errSubmissionNotFound) {
+		http.Error(w, "Unknown reference ID", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Submission status lookup error:", err)
+		http.Error(w, "Failed to look up submission", http.StatusInternalServerError)
+		return
+	}
+
+	state := sub.Status
+	if state == statusReceived || state == statusDeferred || state == statusHeld {
+		state = "pending"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{
+		"referenceId": sub.ID,
+		"status":      state,
+		"updatedAt":   sub.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2/jwt"
+)
+
+const sheetsScope = "https://www.googleapis.com/auth/spreadsheets"
+
+// Appends submissions as rows to a Google Sheet using a service account
+type sheetsClient struct {
+	http          *http.Client
+	spreadsheetID string
+	sheetRange    string
+}
+
+// Set in main when GOOGLE_SHEETS_ID is configured
+var sheets *sheetsClient
+
+// Fields of a service-account key file that the JWT flow needs
+type serviceAccountKey struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+func newSheetsClient(credentialsFile, spreadsheetID, sheetRange string) (*sheetsClient, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	var key serviceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", credentialsFile, err)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("%s is not a service-account key", credentialsFile)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	jwtConfig := &jwt.Config{
+		Email:        key.ClientEmail,
+		PrivateKey:   []byte(key.PrivateKey),
+		PrivateKeyID: key.PrivateKeyID,
+		TokenURL:     key.TokenURI,
+		Scopes:       []string{sheetsScope},
+	}
+	client := jwtConfig.Client(context.Background())
+	client.Timeout = 30 * time.Second
+
+	return &sheetsClient{http: client, spreadsheetID: spreadsheetID, sheetRange: sheetRange}, nil
+}
+
+func (c *sheetsClient) appendRow(row []string) error {
+	values := make([]any, len(row))
+	for i, v := range row {
+		values[i] = v
+	}
+	payload, err := json.Marshal(map[string]any{"values": [][]any{values}})
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("https://sheets.googleapis.com/v4/spreadsheets/%s/values/%s:append?valueInputOption=RAW&insertDataOption=INSERT_ROWS",
+		url.PathEscape(c.spreadsheetID), url.PathEscape(c.sheetRange))
+	resp, err := c.http.Post(endpoint, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("sheets append: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// Row columns: name, email, phone, company, message, timestamp, reference,
+// budget, preferred callback time, UTM source, medium and campaign. New
+// columns go at the end so existing sheets keep lining up.
+func submissionRow(sub *Submission) []string {
+	f := sub.Form
+	return []string{
+		f.FirstName + " " + f.LastName,
+		f.Email,
+		f.Phone,
+		f.Company,
+		f.Message,
+		sub.CreatedAt.Format(time.RFC3339),
+		sub.ID,
+		f.Budget,
+		f.PreferredTime,
+		f.UTMSource,
+		f.UTMMedium,
+		f.UTMCampaign,
+	}
+}
+
+// Append the submission in the background; failures are only logged
+func appendToSheet(sub *Submission) {
+	if sheets == nil {
+		return
+	}
+	row := submissionRow(sub)
+	go func() {
+		if err := sheets.appendRow(row); err != nil {
+			log.Printf("Google Sheets append for %s failed: %v", sub.ID, err)
+		}
+	}()
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Relay used when SMTP_SERVERS is not set
+const (
+	smtpHost = "smtpout.secureserver.net"
+	smtpPort = 587
+)
+
+// One relay from SMTP_SERVERS. Username, Password and Auth default to
+// SMTP_EMAIL, SMTP_PASSWORD and SMTP_AUTH, and Port to 587.
+type smtpServer struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+func (s smtpServer) addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// Parse SMTP_SERVERS, a JSON array of relays tried in order, e.g.
+// [{"host": "smtp.backup.example", "port": 465, "username": "...", "password": "..."}].
+// Empty means the built-in relay with the SMTP_EMAIL account.
+func parseSMTPServers(raw string, cfg *Config) ([]smtpServer, error) {
+	servers := []smtpServer{{Host: smtpHost}}
+	if raw != "" {
+		servers = nil
+		if err := json.Unmarshal([]byte(raw), &servers); err != nil {
+			return nil, err
+		}
+		if len(servers) == 0 {
+			return nil, errors.New("must list at least one server")
+		}
+	}
+	for i := range servers {
+		s := &servers[i]
+		if s.Host == "" {
+			return nil, fmt.Errorf("server %d has no host", i+1)
+		}
+		if s.Port == 0 {
+			s.Port = smtpPort
+		}
+		if s.Username == "" && s.Password == "" {
+			s.Username, s.Password = cfg.SMTPEmail, cfg.SMTPPassword
+		}
+		switch s.Auth = strings.ToLower(s.Auth); s.Auth {
+		case "":
+			s.Auth = cfg.SMTPAuth
+		case smtpAuthPlain, smtpAuthLogin, smtpAuthCRAMMD5:
+		default:
+			return nil, fmt.Errorf("%s: unknown auth mechanism %q", s.addr(), s.Auth)
+		}
+	}
+	return servers, nil
+}
+
+// Sends through the configured SMTP account. Recipients are added one
+// RCPT at a time so a single rejected address doesn't drop the whole
+// message; only a rejected primary (first) recipient fails the send.
+// With SMTP_POOL_SIZE set, connections are reused from smtpConns.
+type smtpMailer struct{}
+
+func (smtpMailer) Send(from string, to []string, msg []byte) error {
+	if len(to) == 0 {
+		return errNoRecipients
+	}
+	for _, addr := range append([]string{from}, to...) {
+		if strings.ContainsAny(addr, "\r\n") {
+			return errors.New("smtp: address contains CR or LF")
+		}
+	}
+
+	if smtpConns != nil {
+		return smtpConns.send(from, to, msg)
+	}
+	c, server, err := dialAnySMTP()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	c.extendDeadline()
+	if err := deliver(c.Client, from, to, msg); err != nil {
+		return err
+	}
+	logSentVia(server)
+	c.extendDeadline()
+	return c.Quit()
+}
+
+// When each SMTP server last failed, for SMTP_FAILOVER_COOLDOWN
+var (
+	smtpFailedMu sync.Mutex
+	smtpFailed   = map[string]time.Time{}
+)
+
+// Whether s failed within the cooldown
+func smtpCoolingDown(s smtpServer, cooldown time.Duration) bool {
+	smtpFailedMu.Lock()
+	defer smtpFailedMu.Unlock()
+	return time.Since(smtpFailed[s.addr()]) < cooldown
+}
+
+// Record the outcome of connecting to s
+func markSMTPFailed(s smtpServer, failed bool) {
+	smtpFailedMu.Lock()
+	defer smtpFailedMu.Unlock()
+	if failed {
+		smtpFailed[s.addr()] = time.Now()
+	} else {
+		delete(smtpFailed, s.addr())
+	}
+}
+
+// Connect to the first of SMTP_SERVERS that accepts the connection and
+// our credentials, skipping servers that failed within
+// SMTP_FAILOVER_COOLDOWN unless every server did. Only connection, TLS
+// and auth failures move on to the next server: once a transaction has
+// started, retrying elsewhere could deliver the message twice.
+func dialAnySMTP() (*smtpConn, smtpServer, error) {
+	cfg := currentConfig()
+	servers := cfg.SMTPServers
+	if len(servers) == 1 {
+		c, err := dialSMTP(servers[0])
+		return c, servers[0], err
+	}
+	candidates := slices.DeleteFunc(slices.Clone(servers), func(s smtpServer) bool {
+		return smtpCoolingDown(s, cfg.SMTPFailoverCooldown)
+	})
+	if len(candidates) == 0 {
+		candidates = servers
+	}
+	var errs []string
+	for i, s := range candidates {
+		c, err := dialSMTP(s)
+		markSMTPFailed(s, err != nil)
+		if err == nil {
+			if s != servers[0] {
+				log.Printf("SMTP failover: using %s, %s unavailable", s.addr(), servers[0].addr())
+			}
+			return c, s, nil
+		}
+		if i < len(candidates)-1 {
+			log.Printf("SMTP server %s unavailable, trying the next one: %v", s.addr(), err)
+		}
+		errs = append(errs, s.addr()+": "+err.Error())
+	}
+	return nil, smtpServer{}, fmt.Errorf("all SMTP servers failed: %s", strings.Join(errs, "; "))
+}
+
+// With failover configured, note which server took the message
+func logSentVia(s smtpServer) {
+	if len(currentConfig().SMTPServers) > 1 {
+		log.Printf("Mail sent via SMTP server %s", s.addr())
+	}
+}
+
+// An SMTP session with its network connection, so every exchange can be
+// held to SMTP_TIMEOUT
+type smtpConn struct {
+	*smtp.Client
+	conn net.Conn
+}
+
+// Give the next exchange SMTP_TIMEOUT from now, so a relay that stalls
+// mid-transaction can't hang the send
+func (c *smtpConn) extendDeadline() {
+	c.conn.SetDeadline(time.Now().Add(currentConfig().SMTPTimeout))
+}
+
+// Open an authenticated connection to one SMTP server, within
+// SMTP_TIMEOUT. The deadline is lifted once logged in, as pooled
+// connections outlive it; callers set a fresh one with extendDeadline
+// before each transaction.
+func dialSMTP(s smtpServer) (*smtpConn, error) {
+	timeout := currentConfig().SMTPTimeout
+	conn, err := (&net.Dialer{Timeout: timeout}).Dial("tcp", s.addr())
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Go's default is "localhost", which strict relays refuse
+	if err := c.Hello(currentConfig().SMTPHeloHost); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if ok, _ := c.Extension("AUTH"); ok {
+		if err := c.Auth(smtpAuth(s)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	return &smtpConn{Client: c, conn: conn}, nil
+}
+
+// SMTP_AUTH mechanisms
+const (
+	smtpAuthPlain   = "plain"
+	smtpAuthLogin   = "login"
+	smtpAuthCRAMMD5 = "cram-md5"
+)
+
+func smtpAuth(s smtpServer) smtp.Auth {
+	switch s.Auth {
+	case smtpAuthLogin:
+		return &loginAuth{username: s.Username, password: s.Password}
+	case smtpAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(s.Username, s.Password)
+	default:
+		return smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+}
+
+// The non-standard but widespread AUTH LOGIN, which net/smtp lacks. Like
+// PlainAuth it refuses to send credentials over an unencrypted connection.
+type loginAuth struct {
+	username, password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("smtp: refusing LOGIN auth over an unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch prompt := strings.ToLower(strings.TrimSpace(string(fromServer))); {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("smtp: unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+// Run one mail transaction on an open connection
+func deliver(c *smtp.Client, from string, to []string, msg []byte) error {
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for i, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			if i == 0 {
+				return fmt.Errorf("primary recipient %s rejected: %w", rcpt, err)
+			}
+			log.Printf("SMTP recipient %s rejected, continuing: %v", rcpt, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// Warm, authenticated SMTP connections, nil unless SMTP_POOL_SIZE > 0
+var smtpConns *smtpPool
+
+// Limit for the NOOP health check on an idle connection; a healthy relay
+// answers at once, so a slow one is treated as stale
+const smtpNoopTimeout = 5 * time.Second
+
+// smtpPool keeps up to size idle connections. A connection is checked with
+// NOOP before reuse and dropped when it fails, has been idle longer than
+// idleTimeout, or goes to a server or credentials that have since been
+// reloaded away. Connections that error mid-transaction are never
+// returned. After a failover, idle connections to the backup are still
+// used until they time out.
+type smtpPool struct {
+	idle        chan *pooledConn
+	idleTimeout time.Duration
+}
+
+type pooledConn struct {
+	*smtpConn
+	server   smtpServer
+	lastUsed time.Time
+}
+
+func newSMTPPool(size int, idleTimeout time.Duration) *smtpPool {
+	return &smtpPool{idle: make(chan *pooledConn, size), idleTimeout: idleTimeout}
+}
+
+func (p *smtpPool) send(from string, to []string, msg []byte) error {
+	pc, err := p.get()
+	if err != nil {
+		return err
+	}
+	pc.extendDeadline()
+	if err := deliver(pc.Client, from, to, msg); err != nil {
+		// The session state is unknown after a failed transaction
+		pc.Close()
+		return err
+	}
+	logSentVia(pc.server)
+	p.put(pc)
+	return nil
+}
+
+// An idle healthy connection, or a freshly dialled one
+func (p *smtpPool) get() (*pooledConn, error) {
+	servers := currentConfig().SMTPServers
+	for {
+		select {
+		case pc := <-p.idle:
+			// Dropped without a QUIT, which a dead relay would only stall
+			if !slices.Contains(servers, pc.server) || time.Since(pc.lastUsed) > p.idleTimeout {
+				pc.Close()
+				continue
+			}
+			pc.conn.SetDeadline(time.Now().Add(smtpNoopTimeout))
+			if err := pc.Noop(); err != nil {
+				debugf("Discarding stale SMTP connection: %v", err)
+				pc.Close()
+				continue
+			}
+			return pc, nil
+		default:
+			c, server, err := dialAnySMTP()
+			if err != nil {
+				return nil, err
+			}
+			return &pooledConn{smtpConn: c, server: server}, nil
+		}
+	}
+}
+
+func (p *smtpPool) put(pc *pooledConn) {
+	pc.lastUsed = time.Now()
+	// Idle connections wait without a deadline, or NOOP would find it
+	// long expired
+	pc.conn.SetDeadline(time.Time{})
+	select {
+	case p.idle <- pc:
+	default:
+		pc.Close()
+	}
+}
+
+// Quit all idle connections, on shutdown
+func (p *smtpPool) close() {
+	for {
+		select {
+		case pc := <-p.idle:
+			pc.extendDeadline()
+			pc.Quit()
+		default:
+			return
+		}
+	}
+}
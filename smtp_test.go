@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSMTPServers(t *testing.T) {
+	cfg := &Config{SMTPEmail: "noreply@next-kiosk.com", SMTPPassword: "secret", SMTPAuth: smtpAuthPlain}
+	tests := []struct {
+		name    string
+		raw     string
+		want    []smtpServer
+		wantErr bool
+	}{
+		{
+			name: "unset uses the built-in relay",
+			want: []smtpServer{{Host: smtpHost, Port: smtpPort, Username: "noreply@next-kiosk.com", Password: "secret", Auth: smtpAuthPlain}},
+		},
+		{
+			name: "defaults and overrides",
+			raw:  `[{"host": "smtp.primary.example"}, {"host": "smtp.backup.example", "port": 465, "username": "backup", "password": "pw", "auth": "LOGIN"}]`,
+			want: []smtpServer{
+				{Host: "smtp.primary.example", Port: smtpPort, Username: "noreply@next-kiosk.com", Password: "secret", Auth: smtpAuthPlain},
+				{Host: "smtp.backup.example", Port: 465, Username: "backup", Password: "pw", Auth: smtpAuthLogin},
+			},
+		},
+		{name: "empty list", raw: `[]`, wantErr: true},
+		{name: "missing host", raw: `[{"port": 25}]`, wantErr: true},
+		{name: "unknown auth", raw: `[{"host": "smtp.example", "auth": "xoauth2"}]`, wantErr: true},
+		{name: "not JSON", raw: `smtp.example:25`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSMTPServers(tt.raw, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Process-wide send outcomes reported by /status
+type sendStatus struct {
+	mu          sync.Mutex
+	startedAt   time.Time
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+	sent        uint64
+	failed      uint64
+
+	// Startup test mail, run in the background
+	selfTestDone  bool
+	selfTestAt    time.Time
+	selfTestError string
+}
+
+var sendStats = &sendStatus{startedAt: time.Now()}
+
+func (s *sendStatus) recordSuccess() {
+	s.mu.Lock()
+	s.lastSuccess = time.Now()
+	s.sent++
+	s.mu.Unlock()
+}
+
+func (s *sendStatus) recordFailure(err error) {
+	s.mu.Lock()
+	s.lastFailure = time.Now()
+	s.lastError = err.Error()
+	s.failed++
+	s.mu.Unlock()
+}
+
+func (s *sendStatus) recordSelfTest(err error) {
+	s.mu.Lock()
+	s.selfTestDone = true
+	s.selfTestAt = time.Now()
+	s.selfTestError = ""
+	if err != nil {
+		s.selfTestError = err.Error()
+	}
+	s.mu.Unlock()
+}
+
+// Outcome of the startup test mail: pending, ok or failed
+type selfTestReport struct {
+	Status string     `json:"status"`
+	At     *time.Time `json:"at,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+type statusReport struct {
+	StartedAt     time.Time      `json:"startedAt"`
+	UptimeSeconds int64          `json:"uptimeSeconds"`
+	LastSuccessAt *time.Time     `json:"lastSuccessAt"`
+	LastFailureAt *time.Time     `json:"lastFailureAt"`
+	LastError     string         `json:"lastError,omitempty"`
+	Sent          uint64         `json:"sent"`
+	Failed        uint64         `json:"failed"`
+	SelfTest      selfTestReport `json:"selfTest"`
+}
+
+func (s *sendStatus) report() statusReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rep := statusReport{
+		StartedAt:     s.startedAt,
+		UptimeSeconds: int64(time.Since(s.startedAt).Seconds()),
+		LastError:     s.lastError,
+		Sent:          s.sent,
+		Failed:        s.failed,
+		SelfTest:      selfTestReport{Status: "pending"},
+	}
+	if !s.lastSuccess.IsZero() {
+		t := s.lastSuccess
+		rep.LastSuccessAt = &t
+	}
+	if !s.lastFailure.IsZero() {
+		t := s.lastFailure
+		rep.LastFailureAt = &t
+	}
+	if s.selfTestDone {
+		t := s.selfTestAt
+		rep.SelfTest = selfTestReport{Status: "ok", At: &t}
+		if s.selfTestError != "" {
+			rep.SelfTest.Status = "failed"
+			rep.SelfTest.Error = s.selfTestError
+		}
+	}
+	return rep
+}
+
+// Stands in for SMTP errors, which can name hosts and accounts, unless
+// the caller has ADMIN_TOKEN or one of MONITOR_API_KEYS
+const redactedSendError = "send failed"
+
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	rep := sendStats.report()
+	if !isAdmin(r) && !hasAPIKey(r, currentConfig().MonitorAPIKeys) {
+		if rep.LastError != "" {
+			rep.LastError = redactedSendError
+		}
+		if rep.SelfTest.Error != "" {
+			rep.SelfTest.Error = redactedSendError
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
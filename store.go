@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Submission lifecycle states
+const (
+	statusReceived = "received"
+	statusSent     = "sent"
+	statusFailed   = "failed"
+	// Stored but not emailed because DAILY_SEND_CAP was reached
+	statusCapped = "capped"
+	// Held back during MAINTENANCE_MODE, or found held for merging at
+	// startup; the retry worker sends it
+	statusDeferred = "deferred"
+	// Waiting in the MERGE_WINDOW buffer
+	statusHeld = "held"
+)
+
+// Submission is the stored record of a single contact form post
+type Submission struct {
+	ID        string      `json:"id"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+	Status    string      `json:"status"`
+	Error     string      `json:"error,omitempty"`
+	Form      ContactForm `json:"form"`
+
+	// Automatic resend attempts made after the initial send failed
+	Retries int `json:"retries,omitempty"`
+	// Allowed Origin the form was posted from, used for routing
+	Origin string `json:"origin,omitempty"`
+	// Uploaded file names and sizes; the files themselves aren't kept,
+	// so a resend goes out without them
+	Attachments []string `json:"attachments,omitempty"`
+	// Markers for the team such as "profanity", shown in the notification
+	Flags []string `json:"flags,omitempty"`
+	// Lead score and priority from leadPriority; empty when scoring is off
+	LeadScore    int    `json:"leadScore,omitempty"`
+	LeadPriority string `json:"leadPriority,omitempty"`
+	// Imported through /api/contact/batch, which never sends auto-replies
+	Batch bool `json:"batch,omitempty"`
+}
+
+var errSubmissionNotFound = errors.New("submission not found")
+
+// SubmissionStore persists submissions by reference ID
+type SubmissionStore interface {
+	Save(sub *Submission) error
+	Get(id string) (*Submission, error)
+	List(status string) ([]*Submission, error)
+}
+
+var store SubmissionStore = newMemoryStore(0)
+
+// Alphabet without look-alike characters (0/O, 1/I) so IDs survive
+// being read back over the phone or retyped in a reply subject
+const referenceAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func newReferenceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = referenceAlphabet[int(b[i])%len(referenceAlphabet)]
+	}
+	return string(b)
+}
+
+func newSubmission(form ContactForm) *Submission {
+	form.Token = ""
+	form.FormToken = ""
+	now := time.Now()
+	sub := &Submission{
+		ID:        newReferenceID(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Status:    statusReceived,
+		Form:      form,
+	}
+	sub.LeadScore, sub.LeadPriority = leadPriority(currentConfig(), form)
+	return sub
+}
+
+// Update the submission status and persist it, logging store failures
+// rather than failing the request
+func recordSubmission(sub *Submission, status string, sendErr error) {
+	sub.Status = status
+	sub.UpdatedAt = time.Now()
+	sub.Error = ""
+	if sendErr != nil {
+		sub.Error = sendErr.Error()
+	}
+	if err := store.Save(sub); err != nil {
+		log.Printf("Submission %s store error: %v", sub.ID, err)
+	}
+}
+
+// In-memory store, used when no SUBMISSIONS_DIR is configured
+type memoryStore struct {
+	mu        sync.RWMutex
+	items     map[string]Submission
+	retention time.Duration
+}
+
+// A zero retention keeps records until restart
+func newMemoryStore(retention time.Duration) *memoryStore {
+	return &memoryStore{items: make(map[string]Submission), retention: retention}
+}
+
+func (s *memoryStore) sweep(now time.Time) {
+	if s.retention <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, sub := range s.items {
+		if now.Sub(sub.UpdatedAt) > s.retention {
+			delete(s.items, id)
+		}
+	}
+}
+
+func (s *memoryStore) Save(sub *Submission) error {
+	s.mu.Lock()
+	s.items[sub.ID] = *sub
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Get(id string) (*Submission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sub, ok := s.items[id]
+	if !ok {
+		return nil, errSubmissionNotFound
+	}
+	return &sub, nil
+}
+
+func (s *memoryStore) List(status string) ([]*Submission, error) {
+	s.mu.RLock()
+	var subs []*Submission
+	for _, sub := range s.items {
+		if status == "" || sub.Status == status {
+			subs = append(subs, &sub)
+		}
+	}
+	s.mu.RUnlock()
+	sortSubmissions(subs)
+	return subs, nil
+}
+
+// File store keeping one JSON document per submission in a directory
+type fileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newFileStore(dir string) (*fileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *fileStore) Save(sub *Submission) error {
+	data, err := json.MarshalIndent(sub, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Write then rename so a crash never leaves a half-written record
+	tmp := s.path(sub.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(sub.ID))
+}
+
+func (s *fileStore) Get(id string) (*Submission, error) {
+	if filepath.Base(id) != id {
+		return nil, errSubmissionNotFound
+	}
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errSubmissionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sub Submission
+	if err := json.Unmarshal(data, &sub); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", id, err)
+	}
+	return &sub, nil
+}
+
+func (s *fileStore) List(status string) ([]*Submission, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var subs []*Submission
+	for _, p := range paths {
+		id := filepath.Base(p)
+		sub, err := s.Get(id[:len(id)-len(".json")])
+		if err != nil {
+			return nil, err
+		}
+		if status == "" || sub.Status == status {
+			subs = append(subs, sub)
+		}
+	}
+	sortSubmissions(subs)
+	return subs, nil
+}
+
+func sortSubmissions(subs []*Submission) {
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CreatedAt.Before(subs[j].CreatedAt)
+	})
+}
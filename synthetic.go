@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+)
+
+// Marks submissions generated by /api/contact/synthetic
+const flagSynthetic = "synthetic"
+
+type syntheticKey struct{}
+
+// Whether the request was generated by syntheticHandler, which skips the
+// reCAPTCHA and form token checks
+func isSynthetic(ctx context.Context) bool {
+	return ctx.Value(syntheticKey{}) != nil
+}
+
+var (
+	syntheticFirstNames = []string{"Ada", "Grace", "Alan", "Şirin", "Mehmet", "Ayşe", "Linus", "Margaret"}
+	syntheticLastNames  = []string{"Lovelace", "Hopper", "Turing", "Yılmaz", "Demir", "Kaya", "Torvalds", "Hamilton"}
+	syntheticCompanies  = []string{"", "Example Ltd", "Acme GmbH", "Kiosk A.Ş."}
+	syntheticMessages   = []string{
+		"We would like a quote for %d kiosks.",
+		"Please call us about %d self-service terminals for our stores.",
+		"Looking for a demo, we have %d locations.",
+	}
+)
+
+// A random submission that passes the default validation rules
+func syntheticForm() ContactForm {
+	pick := func(list []string) string { return list[rand.N(len(list))] }
+	form := ContactForm{
+		FirstName:   pick(syntheticFirstNames),
+		LastName:    pick(syntheticLastNames),
+		Email:       fmt.Sprintf("synthetic-%08x@example.com", rand.Uint32()),
+		Company:     pick(syntheticCompanies),
+		Message:     fmt.Sprintf(pick(syntheticMessages), 1+rand.N(50)),
+		UTMSource:   "synthetic",
+		UTMCampaign: "loadtest",
+	}
+	if rand.N(2) == 0 {
+		form.Phone = fmt.Sprintf("+90 212 %03d %04d", rand.N(1000), rand.N(10000))
+	}
+	if options := currentConfig().BudgetOptions; len(options) > 0 && rand.N(2) == 0 {
+		form.Budget = options[rand.N(len(options))]
+	}
+	return form
+}
+
+// Run a random submission through contactHandler for load testing (POST
+// /api/contact/synthetic). Only reCAPTCHA and the form token are skipped,
+// so rate limits, storage and delivery behave as for real traffic; the
+// response is contactHandler's. Served only with SYNTHETIC_ENDPOINT to
+// ADMIN_TOKEN holders; config refuses it in production and whenever
+// mail, webhooks or Sheets rows would really go out.
+func syntheticHandler(w http.ResponseWriter, r *http.Request) {
+	if !currentConfig().SyntheticEndpoint {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, _ := json.Marshal(syntheticForm())
+	req := r.Clone(context.WithValue(r.Context(), syntheticKey{}, true))
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/json")
+	contactHandler(w, req)
+}
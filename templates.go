@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// The email templates in use. Each one can be replaced by a file of the
+// same name in EMAIL_TEMPLATE_DIR; missing files keep the built-in. The
+// notification's text and HTML versions share notificationView.
+type emailTemplates struct {
+	layout           *template.Template     // layout.html
+	notification     *template.Template     // notification.html
+	notificationText *texttemplate.Template // notification.txt
+	autoReply        *template.Template     // autoreply.html
+	autoReplyText    *template.Template     // autoreply-text.html
+}
+
+var activeTemplates atomic.Pointer[emailTemplates]
+
+func init() {
+	activeTemplates.Store(builtinTemplates())
+}
+
+func currentTemplates() *emailTemplates {
+	return activeTemplates.Load()
+}
+
+func builtinTemplates() *emailTemplates {
+	return &emailTemplates{
+		layout:           htmlLayout,
+		notification:     notificationHTMLContent,
+		notificationText: notificationTextContent,
+		autoReply:        autoReplyHTMLContent,
+		autoReplyText:    textAutoReplyHTMLContent,
+	}
+}
+
+// Parse the templates in dir over the built-ins and trial-render them, so
+// a set that would fail at send time is rejected up front
+func loadTemplates(dir string) (*emailTemplates, error) {
+	t := builtinTemplates()
+	for name, dst := range map[string]**template.Template{
+		"layout.html":         &t.layout,
+		"notification.html":   &t.notification,
+		"autoreply.html":      &t.autoReply,
+		"autoreply-text.html": &t.autoReplyText,
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if *dst, err = template.New(name).Option("missingkey=error").Parse(string(data)); err != nil {
+			return nil, err
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "notification.txt")); err == nil {
+		if t.notificationText, err = texttemplate.New("notification.txt").Option("missingkey=error").Parse(string(data)); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *emailTemplates) check() error {
+	sample := sampleMailData()
+	sub := &Submission{ID: sample.Ref, Form: sample.ContactForm, CreatedAt: time.Now()}
+	for name, run := range map[string]func() error{
+		"layout": func() error {
+			return t.layout.Execute(io.Discard, map[string]any{"LogoCID": logoContentID, "Content": template.HTML(""), "Footer": "Footer"})
+		},
+		"notification":      func() error { return t.notification.Execute(io.Discard, newNotificationView(sub)) },
+		"notification-text": func() error { return t.notificationText.Execute(io.Discard, newNotificationView(sub)) },
+		"autoreply": func() error {
+			return t.autoReply.Execute(io.Discard, map[string]string{"Greeting": "Hi", "Received": "Received", "RefNote": sample.Ref, "SignOff": "Bye"})
+		},
+		"autoreply-text": func() error { return t.autoReplyText.Execute(io.Discard, map[string]string{"Text": "Hello"}) },
+	} {
+		if err := run(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Re-parse EMAIL_TEMPLATE_DIR whenever a file in it changes. Editors often
+// write several events per save, so changes are batched for a moment; a
+// set that fails to parse or render is logged and the previous one stays.
+func watchTemplates(ctx context.Context, dir string) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Println("Email template watch disabled:", err)
+		return
+	}
+	defer watcher.Close()
+	if err := watcher.Add(dir); err != nil {
+		log.Println("Email template watch disabled:", err)
+		return
+	}
+
+	const settle = 200 * time.Millisecond
+	timer := time.NewTimer(settle)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-watcher.Events:
+			if ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create) || ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+				timer.Reset(settle)
+			}
+		case err := <-watcher.Errors:
+			log.Println("Email template watch error:", err)
+		case <-timer.C:
+			t, err := loadTemplates(dir)
+			if err != nil {
+				log.Println("Email template reload failed, keeping the previous templates:", err)
+				continue
+			}
+			activeTemplates.Store(t)
+			log.Println("Email templates reloaded from", dir)
+		}
+	}
+}
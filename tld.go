@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Whether tld is delegated in the root zone, according to the ICANN
+// section of the public suffix list bundled with x/net. Unknown labels
+// fall through to the list's default rule, which isn't an ICANN one.
+func knownTLD(tld string) bool {
+	if tld == "" || strings.Contains(tld, ".") {
+		return false
+	}
+	suffix, icann := publicsuffix.PublicSuffix(tld)
+	return icann && suffix == tld
+}
+
+// Lower-cased top-level domain of an email address
+func emailTLD(addr string) string {
+	domain := strings.TrimSuffix(addr[strings.LastIndex(addr, "@")+1:], ".")
+	return strings.ToLower(domain[strings.LastIndex(domain, ".")+1:])
+}
+
+// With EMAIL_TLDS the address must end in one of them; with CHECK_TLD it
+// must at least end in a real one. New gTLDs appear every year, so the
+// bundled list only moves with x/net and the check is off by default.
+func emailTLDAllowed(v string) string {
+	if v == "" {
+		return ""
+	}
+	cfg := currentConfig()
+	tld := emailTLD(v)
+	if len(cfg.EmailTLDs) > 0 && !cfg.EmailTLDs[tld] {
+		return "must use one of the accepted top-level domains"
+	}
+	if cfg.CheckTLD && !knownTLD(tld) {
+		return "has an unknown top-level domain ." + tld
+	}
+	return ""
+}
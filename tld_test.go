@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestKnownTLD(t *testing.T) {
+	tests := []struct {
+		tld  string
+		want bool
+	}{
+		{"com", true},
+		{"de", true},
+		{"tr", true},
+		{"museum", true},
+		{"xn--p1ai", true},
+		{"", false},
+		{"invalidtld", false},
+		{"co.uk", false},
+		{"local", false},
+	}
+	for _, tt := range tests {
+		if got := knownTLD(tt.tld); got != tt.want {
+			t.Errorf("knownTLD(%q) = %v, want %v", tt.tld, got, tt.want)
+		}
+	}
+}
+
+func TestEmailTLD(t *testing.T) {
+	tests := map[string]string{
+		"jane@example.COM":      "com",
+		"jane@mail.example.de.": "de",
+		"jane@localhost":        "localhost",
+	}
+	for addr, want := range tests {
+		if got := emailTLD(addr); got != want {
+			t.Errorf("emailTLD(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
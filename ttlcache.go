@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ttlCache is a mutex-guarded map whose entries expire after a fixed TTL.
+// Expired entries are ignored on read and removed by the janitor.
+type ttlCache[V any] struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	items map[string]ttlEntry[V]
+}
+
+type ttlEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// Create a cache and register it with the janitor
+func newTTLCache[V any](ttl time.Duration) *ttlCache[V] {
+	c := &ttlCache[V]{ttl: ttl, items: make(map[string]ttlEntry[V])}
+	registerSweeper(c)
+	return c
+}
+
+func (c *ttlCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok || time.Now().After(e.expires) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (c *ttlCache[V]) set(key string, v V) {
+	c.mu.Lock()
+	c.items[key] = ttlEntry[V]{value: v, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+}
+
+// Store v unless a live entry exists; reports whether it was stored
+func (c *ttlCache[V]) add(key string, v V) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if e, ok := c.items[key]; ok && now.Before(e.expires) {
+		return false
+	}
+	c.items[key] = ttlEntry[V]{value: v, expires: now.Add(c.ttl)}
+	return true
+}
+
+func (c *ttlCache[V]) delete(key string) {
+	c.mu.Lock()
+	delete(c.items, key)
+	c.mu.Unlock()
+}
+
+func (c *ttlCache[V]) sweep(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.items {
+		if now.After(e.expires) {
+			delete(c.items, k)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FieldError describes a single failed validation rule
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// check returns an error message for an invalid value, or "" when it passes.
+// Checks other than required ignore empty values.
+type check func(value string) string
+
+// fieldRule lists the checks for one form field, keyed by its JSON name
+type fieldRule struct {
+	field  string
+	value  func(form *ContactForm) string
+	checks []check
+}
+
+// Anything that looks like an opening or closing HTML tag or comment
+var tagRegexp = regexp.MustCompile(`<\s*[/!?]?\s*[a-zA-Z]`)
+
+// All submission constraints, evaluated in order by validate
+var formRules = []fieldRule{
+	{"firstName", func(f *ContactForm) string { return f.FirstName }, []check{required, maxLenOf("firstName"), noHiddenChars, plainText}},
+	{"lastName", func(f *ContactForm) string { return f.LastName }, []check{required, maxLenOf("lastName"), noHiddenChars, plainText}},
+	{"email", func(f *ContactForm) string { return f.Email }, []check{required, maxLenOf("email"), noHiddenChars, emailFormat, emailTLDAllowed, notDisposable}},
+	{"phone", func(f *ContactForm) string { return f.Phone }, []check{maxLenOf("phone"), noHiddenChars, plainText}},
+	{"company", func(f *ContactForm) string { return f.Company }, []check{maxLenOf("company"), noHiddenChars, plainText}},
+	{"budget", func(f *ContactForm) string { return f.Budget }, []check{budgetOption}},
+	{"preferredTime", func(f *ContactForm) string { return f.PreferredTime }, []check{callbackTime}},
+	{"message", func(f *ContactForm) string { return f.Message }, []check{required, maxLenOf("message"), noHiddenChars, noMarkup}},
+	{"utmSource", func(f *ContactForm) string { return f.UTMSource }, []check{maxLenOf("utmSource"), noControlChars, noHiddenChars}},
+	{"utmMedium", func(f *ContactForm) string { return f.UTMMedium }, []check{maxLenOf("utmMedium"), noControlChars, noHiddenChars}},
+	{"utmCampaign", func(f *ContactForm) string { return f.UTMCampaign }, []check{maxLenOf("utmCampaign"), noControlChars, noHiddenChars}},
+}
+
+// Run every rule and return all failures, at most one per field
+func validate(form ContactForm) []FieldError {
+	var errs []FieldError
+	for _, rule := range formRules {
+		v := rule.value(&form)
+		if v == "" {
+			if msg := requiredByCondition(rule.field, &form); msg != "" {
+				errs = append(errs, FieldError{Field: rule.field, Message: msg})
+				continue
+			}
+		}
+		for _, c := range rule.checks {
+			if msg := c(v); msg != "" {
+				errs = append(errs, FieldError{Field: rule.field, Message: msg})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func required(v string) string {
+	if v == "" {
+		return "is required"
+	}
+	return ""
+}
+
+func maxLen(n int) check {
+	return func(v string) string {
+		if utf8.RuneCountInString(v) > n {
+			return fmt.Sprintf("must be at most %d characters", n)
+		}
+		return ""
+	}
+}
+
+// Length limit configured for a field in Config.MaxLengths
+func maxLenOf(field string) check {
+	return func(v string) string {
+		if n, ok := currentConfig().MaxLengths[field]; ok && n > 0 {
+			return maxLen(n)(v)
+		}
+		return ""
+	}
+}
+
+func emailFormat(v string) string {
+	if v != "" && !isValidEmail(v) {
+		return "is not a valid email address"
+	}
+	return ""
+}
+
+func notDisposable(v string) string {
+	if v != "" && isDisposableEmail(v) {
+		return "must not be a disposable email address"
+	}
+	return ""
+}
+
+// Budget must be one of BUDGET_OPTIONS when given
+func budgetOption(v string) string {
+	options := currentConfig().BudgetOptions
+	if v != "" && !slices.Contains(options, v) {
+		return "must be one of " + strings.Join(options, ", ")
+	}
+	return ""
+}
+
+// A preferred callback time must be a future RFC 3339 timestamp within
+// business hours in the display timezone
+func callbackTime(v string) string {
+	if v == "" {
+		return ""
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return "must be an RFC 3339 timestamp"
+	}
+	if !t.After(time.Now()) {
+		return "must be in the future"
+	}
+	if hours := currentConfig().BusinessHours; !hours.contains(localTime(t)) {
+		return "must be within business hours (" + hours.String() + " " + localTime(t).Location().String() + ")"
+	}
+	return ""
+}
+
+// With STRICT_FIELD_VALIDATION, short fields may not contain angle
+// brackets or NUL bytes at all
+func plainText(v string) string {
+	if currentConfig().StrictFields && strings.ContainsAny(v, "<>\x00") {
+		return "contains characters that are not allowed"
+	}
+	return ""
+}
+
+// Single-line values such as UTM tags may not contain line breaks, tabs
+// or other control characters
+func noControlChars(v string) string {
+	if strings.IndexFunc(v, unicode.IsControl) >= 0 {
+		return "must not contain control characters"
+	}
+	return ""
+}
+
+// Bidirectional overrides and isolates can make a name render as a
+// different address in the inbox preview, and zero-width characters hide
+// inside look-alike text, so neither is accepted in any field
+func noHiddenChars(v string) string {
+	for _, r := range v {
+		switch {
+		case r >= '\u202A' && r <= '\u202E', r >= '\u2066' && r <= '\u2069',
+			r == '\u200E', r == '\u200F', // left-to-right and right-to-left marks
+			r >= '\u200B' && r <= '\u200D', r == '\u2060', r == '\uFEFF':
+			return "contains invisible or text-direction characters"
+		}
+	}
+	return ""
+}
+
+// The message may legitimately use symbols like "a < b", so it is only
+// rejected for NUL bytes or tag-like markup
+func noMarkup(v string) string {
+	if !currentConfig().StrictFields {
+		return ""
+	}
+	if strings.ContainsRune(v, 0) || tagRegexp.MatchString(v) {
+		return "must not contain HTML or script markup"
+	}
+	return ""
+}
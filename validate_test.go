@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFieldChecks(t *testing.T) {
+	tests := []struct {
+		name  string
+		check check
+		value string
+		fails bool
+	}{
+		{"required empty", required, "", true},
+		{"required set", required, "Jane", false},
+		{"maxLen within", maxLen(4), "Ayşe", false},
+		{"maxLen counts runes", maxLen(5), "Şirin", false},
+		{"maxLen over", maxLen(3), "Jane", true},
+		{"email valid", emailFormat, "jane.doe@example.org", false},
+		{"email without domain", emailFormat, "jane@", true},
+		{"email empty is left to required", emailFormat, "", false},
+		{"disposable", notDisposable, "bot@mailinator.com", true},
+		{"not disposable", notDisposable, "jane@example.org", false},
+		{"control characters", noControlChars, "spring\nsale", true},
+		{"no control characters", noControlChars, "spring-sale", false},
+		{"bidi override", noHiddenChars, "Jane\u202eexe.gpj", true},
+		{"zero-width space", noHiddenChars, "Ja\u200bne", true},
+		{"plain text", noHiddenChars, "Jane Doe", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if msg := tt.check(tt.value); (msg != "") != tt.fails {
+				t.Errorf("check(%q) = %q, want failure %v", tt.value, msg, tt.fails)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	prev := activeConfig.Swap(&Config{MaxLengths: map[string]int{"firstName": 10, "message": 20}})
+	t.Cleanup(func() { activeConfig.Store(prev) })
+
+	tests := []struct {
+		name string
+		form ContactForm
+		want []string
+	}{
+		{
+			name: "valid",
+			form: ContactForm{FirstName: "Jane", LastName: "Doe", Email: "jane@example.org", Message: "A quote, please."},
+		},
+		{
+			name: "every failure reported, one per field",
+			form: ContactForm{FirstName: "Janette-Marie", Email: "jane@", Message: "This message is far too long."},
+			want: []string{"firstName", "lastName", "email", "message"},
+		},
+		{
+			name: "optional fields are checked when set",
+			form: ContactForm{FirstName: "Jane", LastName: "Doe", Email: "jane@example.org", Message: "Hi", UTMSource: "news\tletter"},
+			want: []string{"utmSource"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, e := range validate(tt.form) {
+				got = append(got, e.Field)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("failed fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
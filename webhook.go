@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// One POST of a submission to one WEBHOOK_URLS endpoint
+type webhookDelivery struct {
+	URL string
+	// Position in WEBHOOK_URLS, logged and dead-lettered instead of the
+	// URL, which may carry a token
+	Index    int
+	Ref      string
+	Payload  []byte
+	Attempts int
+}
+
+// Bounded queue of pending deliveries. Failed deliveries are re-queued
+// after WEBHOOK_BACKOFF, doubling per attempt, and dead-lettered after
+// WEBHOOK_MAX_ATTEMPTS or when the queue is full, and on shutdown.
+type webhookQueue struct {
+	pending chan *webhookDelivery
+	client  *http.Client
+	// Guards retrying and closed; held while sending to pending so close
+	// can't miss a delivery
+	stateMu sync.Mutex
+	// Deliveries waiting out their backoff
+	retrying map[*webhookDelivery]*time.Timer
+	closed   bool
+	// Serializes appends to the dead-letter file
+	mu sync.Mutex
+}
+
+var errWebhooksClosed = errors.New("shut down before delivery")
+
+// Set up in main when WEBHOOK_URLS is set
+var webhooks *webhookQueue
+
+func newWebhookQueue(size int, timeout time.Duration) *webhookQueue {
+	return &webhookQueue{
+		pending:  make(chan *webhookDelivery, size),
+		client:   &http.Client{Timeout: timeout},
+		retrying: make(map[*webhookDelivery]*time.Timer),
+	}
+}
+
+// JSON body sent to webhooks
+type webhookPayload struct {
+	Event       string      `json:"event"`
+	ReferenceID string      `json:"referenceId"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	Origin      string      `json:"origin,omitempty"`
+	Form        ContactForm `json:"form"`
+	Attachments []string    `json:"attachments,omitempty"`
+}
+
+// Queue sub for every configured webhook
+func notifyWebhooks(sub *Submission) {
+	if webhooks == nil {
+		return
+	}
+	payload, err := json.Marshal(webhookPayload{
+		Event:       "submission.received",
+		ReferenceID: sub.ID,
+		CreatedAt:   sub.CreatedAt.UTC(),
+		Origin:      sub.Origin,
+		Form:        sub.Form,
+		Attachments: sub.Attachments,
+	})
+	if err != nil {
+		log.Printf("Webhook payload for %s: %v", sub.ID, err)
+		return
+	}
+	for i, u := range currentConfig().WebhookURLs {
+		webhooks.enqueue(&webhookDelivery{URL: u, Index: i, Ref: sub.ID, Payload: payload})
+	}
+}
+
+// The endpoint as it may be logged: its WEBHOOK_URLS index and host,
+// without path, query or credentials
+func (d *webhookDelivery) name() string {
+	u, err := url.Parse(d.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Sprintf("#%d", d.Index)
+	}
+	return fmt.Sprintf("#%d (%s://%s)", d.Index, u.Scheme, u.Host)
+}
+
+func (q *webhookQueue) enqueue(d *webhookDelivery) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	if q.closed {
+		q.deadLetter(d, errWebhooksClosed)
+		return
+	}
+	select {
+	case q.pending <- d:
+	default:
+		q.deadLetter(d, fmt.Errorf("queue full"))
+	}
+}
+
+// Queue d again after delay
+func (q *webhookQueue) retryLater(d *webhookDelivery, delay time.Duration) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	if q.closed {
+		q.deadLetter(d, errWebhooksClosed)
+		return
+	}
+	q.retrying[d] = time.AfterFunc(delay, func() {
+		q.stateMu.Lock()
+		delete(q.retrying, d)
+		q.stateMu.Unlock()
+		q.enqueue(d)
+	})
+}
+
+// Stop taking deliveries, once run has returned and no more submissions
+// come in. Whatever is still queued or waiting for a retry is
+// dead-lettered rather than lost.
+func (q *webhookQueue) close() {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	q.closed = true
+	for d, t := range q.retrying {
+		// A timer that already fired finds the queue closed in enqueue
+		if t.Stop() {
+			q.deadLetter(d, errWebhooksClosed)
+		}
+	}
+	clear(q.retrying)
+	for {
+		select {
+		case d := <-q.pending:
+			q.deadLetter(d, errWebhooksClosed)
+		default:
+			return
+		}
+	}
+}
+
+// Deliver queued webhooks until ctx is cancelled
+func (q *webhookQueue) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-q.pending:
+			q.attempt(ctx, d)
+		}
+	}
+}
+
+func (q *webhookQueue) attempt(ctx context.Context, d *webhookDelivery) {
+	err := q.post(ctx, d)
+	if err == nil {
+		debugf("Webhook %s delivered for %s", d.name(), d.Ref)
+		return
+	}
+	d.Attempts++
+	cfg := currentConfig()
+	// A delivery cut off by shutdown won't get another attempt
+	if d.Attempts >= cfg.WebhookMaxAttempts || ctx.Err() != nil {
+		q.deadLetter(d, err)
+		return
+	}
+	delay := cfg.WebhookBackoff << (d.Attempts - 1)
+	log.Printf("Webhook %s for %s failed (attempt %d), retrying in %s: %v", d.name(), d.Ref, d.Attempts, delay, err)
+	q.retryLater(d, delay)
+}
+
+func (q *webhookQueue) post(ctx context.Context, d *webhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := q.client.Do(req)
+	if err != nil {
+		// The *url.Error would repeat the full URL in every log line
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			return uerr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// Record a delivery that won't be retried, as a JSON line in
+// WEBHOOK_DEAD_LETTER_FILE when set, so it can be replayed by hand to
+// the WEBHOOK_URLS entry at its "webhook" index
+func (q *webhookQueue) deadLetter(d *webhookDelivery, cause error) {
+	log.Printf("Webhook %s for %s given up after %d attempts: %v", d.name(), d.Ref, d.Attempts, cause)
+	path := currentConfig().WebhookDeadLetterFile
+	if path == "" {
+		return
+	}
+	line, err := json.Marshal(map[string]any{
+		"time":        time.Now().UTC(),
+		"webhook":     d.Index,
+		"referenceId": d.Ref,
+		"attempts":    d.Attempts,
+		"error":       cause.Error(),
+		"payload":     json.RawMessage(d.Payload),
+	})
+	if err != nil {
+		log.Println("Webhook dead letter encode error:", err)
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		log.Println("Webhook dead letter file:", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Println("Webhook dead letter write error:", err)
+	}
+}